@@ -21,6 +21,7 @@ let hasHitMaxRetries = false;
 let retryAttempt = 0;
 let maxRetryAttempts = 5;
 let authToken = null;
+let currentUtteranceId = null; // ID of the sentence currently being spoken
 
 // Main initialization function
 function initializeContentScript() {
@@ -248,13 +249,23 @@ function setupSpeechRecognition() {
   recognition.onresult = (event) => {
     if (!isTranslating || !ws || ws.readyState !== WebSocket.OPEN) return;
 
+    let interim = '';
     for (let i = event.resultIndex; i < event.results.length; i++) {
       const transcript = event.results[i][0].transcript;
+      if (!currentUtteranceId) {
+        currentUtteranceId = newUtteranceId();
+      }
       if (event.results[i].isFinal) {
         console.log('Final transcript:', transcript);
-        sendMessage(transcript);
+        sendMessage(transcript, currentUtteranceId);
+        currentUtteranceId = null;
+      } else {
+        interim += transcript;
       }
     }
+    if (interim.trim() && currentUtteranceId) {
+      sendInterim(interim, currentUtteranceId);
+    }
   };
 
   recognition.onerror = (event) => {
@@ -388,7 +399,20 @@ async function connectToRoom() {
       const data = JSON.parse(event.data);
       if (data.type === 'message') {
         console.log('Displaying message:', data);
-        displayMessage(data.text, false, data.name || 'Anonymous');
+        displayMessage(data.text, false, data.name || 'Anonymous', data.id);
+      } else if (data.type === 'message_delta' || data.type === 'interim') {
+        // Partial translation; the final message with the same id replaces it
+        displayMessage(data.text, false, data.name || 'Anonymous', data.id);
+      } else if (data.type === 'error') {
+        console.error('Server rejected request:', data.text);
+      } else if (data.type === 'quota_exceeded') {
+        // Our messages are still delivered, but untranslated
+        console.warn('Translation quota exceeded:', data.text);
+        const status = document.getElementById('shabe-status');
+        if (status) {
+          status.textContent = 'Quota exceeded';
+          status.style.color = '#ff9800';
+        }
       }
     } catch (error) {
       console.error('Error handling websocket message:', error);
@@ -400,25 +424,29 @@ async function connectToRoom() {
 function sendPreferences() {
   if (!ws || ws.readyState !== WebSocket.OPEN) return;
 
-  chrome.storage.local.get(['language', 'userName'], (items) => {
+  chrome.storage.local.get(['language', 'userName', 'formality'], (items) => {
     let language = items.language
     let name = items.userName
+    let formality = items.formality
     if (!language) language = 'en'
     if (!name) name = 'Anonymous'
+    if (!formality) formality = 'auto'
   
-    console.log('Sending preferences:', { language, name });
+    console.log('Sending preferences:', { language, name, formality });
 
     ws.send(JSON.stringify({
       type: 'preferences',
       language: language,
-      name: name
+      name: name,
+      formality: formality
     }));
   });
 }
 
-// Function to display a message
-function displayMessage(text, isSelf = false, name = 'Anonymous') {
-  console.log('Displaying message:', { text, isSelf, name });
+// Function to display a message. Messages with an id update the message
+// already shown with that id, if any.
+function displayMessage(text, isSelf = false, name = 'Anonymous', id = null) {
+  console.log('Displaying message:', { text, isSelf, name, id });
   
   const messagesDiv = document.getElementById('messages');
   if (!messagesDiv) {
@@ -426,8 +454,20 @@ function displayMessage(text, isSelf = false, name = 'Anonymous') {
     return;
   }
 
+  if (id) {
+    const existing = messagesDiv.querySelector(`.shabe-message[data-id="${CSS.escape(id)}"] .shabe-message-text`);
+    if (existing) {
+      existing.textContent = text;
+      messagesDiv.scrollTop = messagesDiv.scrollHeight;
+      return;
+    }
+  }
+
   const messageDiv = document.createElement('div');
   messageDiv.className = `shabe-message ${isSelf ? 'self' : 'other'}`;
+  if (id) {
+    messageDiv.dataset.id = id;
+  }
   messageDiv.style.cssText = `
     margin: 5px 0px 0px 5px;
     padding: 5px 8px;
@@ -458,8 +498,24 @@ function displayMessage(text, isSelf = false, name = 'Anonymous') {
   messagesDiv.scrollTop = messagesDiv.scrollHeight;
 }
 
+// Function to create an ID tying interim transcripts to their final message
+function newUtteranceId() {
+  return `${Date.now().toString(36)}-${Math.random().toString(36).slice(2, 10)}`;
+}
+
+// Function to send the transcript so far of a sentence still being spoken.
+// The server decides how often it is translated.
+function sendInterim(text, id) {
+  if (!ws || ws.readyState !== WebSocket.OPEN) return;
+  ws.send(JSON.stringify({
+    type: 'interim',
+    id: id,
+    text: text
+  }));
+}
+
 // Function to send a message
-function sendMessage(text) {
+function sendMessage(text, id = null) {
   console.log('Sending message:', text);
   if (!ws || ws.readyState !== WebSocket.OPEN || !text.trim()) {
     console.error('Cannot send message:', { 
@@ -478,6 +534,7 @@ function sendMessage(text) {
   
     const message = {
       type: 'message',
+      id: id || undefined,
       text: text,
       language: language,
       name: name
@@ -537,6 +594,23 @@ function setupLanguageSelect(languageSelect) {
   }
 }
 
+// Helper function to set up formality select event listener
+function setupFormalitySelect(formalitySelect) {
+  if (formalitySelect) {
+    chrome.storage.local.get('formality', (items) => {
+      formalitySelect.value = items.formality || 'auto';
+      formalitySelect.addEventListener('change', (e) => {
+        chrome.storage.local.set({ formality: e.target.value });
+
+        // Send preferences to server if connected
+        if (ws) {
+          sendPreferences();
+        }
+      });
+    });
+  }
+}
+
 // Helper function to set up translation view event listeners
 function setupTranslationViewListeners(container) {
   if (!container) {
@@ -548,6 +622,10 @@ function setupTranslationViewListeners(container) {
   const languageSelect = container.querySelector('.shabe-language-select');
   setupLanguageSelect(languageSelect);
 
+  // Add formality select event listener
+  const formalitySelect = container.querySelector('.shabe-formality-select');
+  setupFormalitySelect(formalitySelect);
+
   // Add mic button event listener
   const micButton = container.querySelector('.shabe-mic-button');
   setupMicButton(micButton);
@@ -666,6 +744,11 @@ function createDetachedWindow() {
               <option value="ko">한국어</option>
               <option value="zh">中文</option>
             </select>
+            <select class="shabe-formality-select" title="Formality" style="padding: 5px; border-radius: 4px; border: 1px solid #ddd;">
+              <option value="auto">Auto</option>
+              <option value="formal">Formal</option>
+              <option value="informal">Casual</option>
+            </select>
             <button class="shabe-mic-button" style="padding: 8px; border: none; background: none;">
               <span class="google-symbols">mic</span>
             </button>
@@ -684,6 +767,10 @@ function createDetachedWindow() {
   const languageSelect = popup.querySelector('.shabe-language-select');
   setupLanguageSelect(languageSelect);
 
+  // Set up formality select
+  const formalitySelect = popup.querySelector('.shabe-formality-select');
+  setupFormalitySelect(formalitySelect);
+
   // Set up mic button
   const micButton = popup.querySelector('.shabe-mic-button');
   setupMicButton(micButton);
@@ -910,6 +997,11 @@ function initializeUI() {
               <option value="ko">한국어</option>
               <option value="zh">中文</option>
         </select>
+        <select class="shabe-formality-select" title="Formality" style="padding: 5px; border-radius: 4px; border: 1px solid #ddd;">
+          <option value="auto">Auto</option>
+          <option value="formal">Formal</option>
+          <option value="informal">Casual</option>
+        </select>
         <button class="shabe-mic-button" style="padding: 8px; border: none; background: none; cursor: pointer;">
           <span class="google-symbols">mic</span>
         </button>
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -255,12 +256,64 @@ func (m *Manager) AuthMiddleware(next http.Handler) http.Handler {
 		}
 
 		// Verify token by getting user info
-		_, err := m.GetUserInfo(token)
+		userInfo, err := m.GetUserInfo(token)
 		if err != nil {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), userInfo)))
+	})
+}
+
+// userKey is the context key for the authenticated user of a request
+type userKey struct{}
+
+// NewContext returns a copy of ctx carrying the authenticated user
+func NewContext(ctx context.Context, user *UserInfo) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// FromContext returns the authenticated user carried by ctx, or nil if
+// there is none
+func FromContext(ctx context.Context) *UserInfo {
+	user, _ := ctx.Value(userKey{}).(*UserInfo)
+	return user
+}
+
+// IsAdmin reports whether email is listed in admins
+func IsAdmin(admins []string, email string) bool {
+	if email == "" {
+		return false
+	}
+	for _, admin := range admins {
+		if strings.EqualFold(admin, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminMiddleware creates a middleware that only lets through authenticated
+// users whose email is in admins. With no admins configured every request is
+// refused.
+func (m *Manager) AdminMiddleware(admins []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := getTokenFromHeader(r.Header.Get("Authorization"))
+		if token == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		userInfo, err := m.GetUserInfo(token)
+		if err != nil {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		if !IsAdmin(admins, userInfo.Email) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), userInfo)))
 	})
 }
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -160,6 +161,49 @@ func TestAuthMiddleware(t *testing.T) {
 	}
 }
 
+func TestAdminMiddleware(t *testing.T) {
+	manager := NewManager(&Config{
+		ClientID:     "test-client-id",
+		ClientSecret: "test-client-secret",
+		RedirectURL:  "http://localhost:8080/auth/callback",
+	})
+	manager.getUserInfoFunc = func(token string) (*UserInfo, error) {
+		if token != "mock-token" {
+			return nil, errors.New("invalid token")
+		}
+		return &UserInfo{ID: "123", Email: "admin@example.com"}, nil
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	tests := []struct {
+		name   string
+		admins []string
+		token  string
+		want   int
+	}{
+		{"no token", []string{"admin@example.com"}, "", http.StatusUnauthorized},
+		{"invalid token", []string{"admin@example.com"}, "invalid-token", http.StatusUnauthorized},
+		{"admin", []string{"Admin@Example.com"}, "mock-token", http.StatusOK},
+		{"not an admin", []string{"other@example.com"}, "mock-token", http.StatusForbidden},
+		{"no admins", nil, "mock-token", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/admin/usage", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			manager.AdminMiddleware(tt.admins, next).ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("Expected status code %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
 func TestManager_HandleAuthVerify(t *testing.T) {
 	manager := NewManager(&Config{
 		ClientID:     "test-client-id",
@@ -1,34 +1,188 @@
 package chat
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/gorilla/websocket"
 )
 
+var (
+	// ErrSendQueueFull is returned when a message is dropped because a
+	// client's outbound queue is full
+	ErrSendQueueFull = errors.New("send queue full")
+	// ErrSlowConsumer is returned when a client is disconnected for falling behind
+	ErrSlowConsumer = errors.New("slow consumer disconnected")
+	// ErrClientClosed is returned when sending to a closed client
+	ErrClientClosed = errors.New("client closed")
+)
+
+// OverflowPolicy determines what happens when a client's send queue is full
+type OverflowPolicy int
+
+const (
+	// DropOldest discards the oldest queued message to make room for the new one
+	DropOldest OverflowPolicy = iota
+	// DropNewest discards the message being sent
+	DropNewest
+	// Disconnect closes the client's connection
+	Disconnect
+)
+
+// String returns the configuration name of the policy
+func (p OverflowPolicy) String() string {
+	switch p {
+	case DropOldest:
+		return "drop_oldest"
+	case DropNewest:
+		return "drop_newest"
+	case Disconnect:
+		return "disconnect"
+	default:
+		return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+	}
+}
+
+// ParseOverflowPolicy parses a policy name as returned by OverflowPolicy.String
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	for _, p := range []OverflowPolicy{DropOldest, DropNewest, Disconnect} {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown overflow policy: %s", name)
+}
+
+// ClientOptions configures a client's outbound queue and heartbeat
+type ClientOptions struct {
+	SendQueueSize  int
+	OverflowPolicy OverflowPolicy
+
+	// PingInterval is how often the server pings the peer; zero disables pings
+	PingInterval time.Duration
+	// PongWait is how long the peer may stay silent before it is considered
+	// dead; zero disables the read deadline, as does disabling pings, since
+	// peers that only listen would otherwise be dropped
+	PongWait time.Duration
+	// WriteWait bounds how long a single write may take
+	WriteWait time.Duration
+}
+
+// DefaultClientOptions returns the options used by NewClient
+func DefaultClientOptions() ClientOptions {
+	return ClientOptions{
+		SendQueueSize:  64,
+		OverflowPolicy: DropOldest,
+		PingInterval:   30 * time.Second,
+		PongWait:       60 * time.Second,
+		WriteWait:      10 * time.Second,
+	}
+}
+
+// clientConn is the subset of *websocket.Conn used by Client
+type clientConn interface {
+	WriteJSON(v interface{}) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	ReadMessage() (int, []byte, error)
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetPongHandler(h func(appData string) error)
+	Close() error
+}
+
 // Client represents a connected chat client
 type Client struct {
-	conn     *websocket.Conn
-	name     string
-	email    string
-	language string
+	id        string
+	conn      clientConn
+	name      string
+	email     string
+	language  string
+	formality string // formal, informal or auto, which follows the room default
+	mu        sync.RWMutex
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	send      chan interface{}
+	opts      ClientOptions
+	dropped   atomic.Uint64
+	done      chan struct{}
+	closeOnce sync.Once
+	pongOnce  sync.Once
 }
 
-// NewClient creates a new chat client
+// NewClient creates a new chat client with the default options
 func NewClient(conn *websocket.Conn, name, email string) *Client {
-	return &Client{
-		conn:     conn,
-		name:     name,
-		email:    email,
-		language: "en", // Default to English
+	return NewClientWithOptions(conn, name, email, DefaultClientOptions())
+}
+
+// NewClientWithOptions creates a new chat client and starts its write pump
+func NewClientWithOptions(conn *websocket.Conn, name, email string, opts ClientOptions) *Client {
+	return newClient(conn, name, email, opts)
+}
+
+func newClient(conn clientConn, name, email string, opts ClientOptions) *Client {
+	if opts.SendQueueSize <= 0 {
+		opts.SendQueueSize = DefaultClientOptions().SendQueueSize
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		id:        newClientID(),
+		ctx:       ctx,
+		cancel:    cancel,
+		conn:      conn,
+		name:      name,
+		email:     email,
+		language:  "en", // Default to English
+		formality: "auto",
+		send:      make(chan interface{}, opts.SendQueueSize),
+		opts:      opts,
+		done:      make(chan struct{}),
 	}
+	go c.writePump()
+	return c
+}
+
+// newClientID returns a random identifier for a connection
+func newClientID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("Error generating client ID: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// GetID returns the identifier of the client's connection
+func (c *Client) GetID() string {
+	return c.id
+}
+
+// Context returns a context that is cancelled when the client is closed, so
+// work done on the client's behalf stops once it disconnects
+func (c *Client) Context() context.Context {
+	return c.ctx
 }
 
 // GetName returns the client's name
 func (c *Client) GetName() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.name
 }
 
 // SetName sets the client's name
 func (c *Client) SetName(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.name = name
 }
 
@@ -37,27 +191,171 @@ func (c *Client) GetEmail() string {
 	return c.email
 }
 
+// GetEmailHash returns a SHA-256 hash of the client's normalized email, which
+// identifies the user to other participants without revealing the address
+func (c *Client) GetEmailHash() string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(c.email))))
+	return hex.EncodeToString(sum[:])
+}
+
 // GetLanguage returns the client's preferred language
 func (c *Client) GetLanguage() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.language
 }
 
 // SetLanguage sets the client's preferred language
 func (c *Client) SetLanguage(lang string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.language = lang
 }
 
-// WriteJSON writes a JSON message to the client
+// GetFormality returns the client's preferred formality
+func (c *Client) GetFormality() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.formality
+}
+
+// SetFormality sets the client's preferred formality
+func (c *Client) SetFormality(formality string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.formality = formality
+}
+
+// Send queues a message for delivery by the client's write pump without
+// blocking the caller. When the queue is full the client's overflow policy
+// decides whether a message is dropped or the client is disconnected.
+func (c *Client) Send(v interface{}) error {
+	select {
+	case <-c.done:
+		return ErrClientClosed
+	default:
+	}
+
+	select {
+	case c.send <- v:
+		return nil
+	default:
+	}
+
+	switch c.opts.OverflowPolicy {
+	case DropOldest:
+		select {
+		case <-c.send:
+			c.recordDrop()
+		default:
+		}
+		select {
+		case c.send <- v:
+			return nil
+		default:
+			c.recordDrop()
+			return ErrSendQueueFull
+		}
+	case Disconnect:
+		log.Printf("Disconnecting slow client %s", c.GetName())
+		c.Close()
+		return ErrSlowConsumer
+	default:
+		c.recordDrop()
+		return ErrSendQueueFull
+	}
+}
+
+// recordDrop counts a dropped message and logs the running total
+func (c *Client) recordDrop() {
+	total := c.dropped.Add(1)
+	log.Printf("Dropped message for slow client %s (policy=%s, total dropped=%d)", c.GetName(), c.opts.OverflowPolicy, total)
+}
+
+// Dropped returns the number of messages dropped for this client
+func (c *Client) Dropped() uint64 {
+	return c.dropped.Load()
+}
+
+// writePump writes queued messages and heartbeat pings to the connection until
+// the client is closed. It is the only goroutine that writes to the connection.
+func (c *Client) writePump() {
+	var ping <-chan time.Time
+	if c.opts.PingInterval > 0 {
+		ticker := time.NewTicker(c.opts.PingInterval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ping:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, c.writeDeadline()); err != nil {
+				log.Printf("Error pinging client %s: %v", c.GetName(), err)
+				c.Close()
+				return
+			}
+		case v := <-c.send:
+			if c.opts.WriteWait > 0 {
+				c.conn.SetWriteDeadline(c.writeDeadline())
+			}
+			if err := c.conn.WriteJSON(v); err != nil {
+				log.Printf("Error writing to client %s: %v", c.GetName(), err)
+				c.Close()
+				return
+			}
+		}
+	}
+}
+
+// writeDeadline returns the deadline for a write started now
+func (c *Client) writeDeadline() time.Time {
+	if c.opts.WriteWait <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(c.opts.WriteWait)
+}
+
+// extendReadDeadline gives the peer another PongWait to show it is alive
+func (c *Client) extendReadDeadline() error {
+	return c.conn.SetReadDeadline(time.Now().Add(c.opts.PongWait))
+}
+
+// WriteJSON queues a JSON message for the client's write pump
 func (c *Client) WriteJSON(v interface{}) error {
-	return c.conn.WriteJSON(v)
+	return c.Send(v)
 }
 
-// ReadMessage reads a message from the client's connection
+// ReadMessage reads a message from the client's connection. Every message or
+// pong received extends the read deadline; a peer that stays silent for longer
+// than PongWait causes the read to fail with a timeout. Without pings there
+// is no deadline.
 func (c *Client) ReadMessage() (int, []byte, error) {
+	if c.opts.PingInterval > 0 && c.opts.PongWait > 0 {
+		c.pongOnce.Do(func() {
+			c.conn.SetPongHandler(func(string) error {
+				return c.extendReadDeadline()
+			})
+		})
+		if err := c.extendReadDeadline(); err != nil {
+			return 0, nil, err
+		}
+	}
 	return c.conn.ReadMessage()
 }
 
-// Close closes the client's connection
+// Close stops the client's write pump and closes its connection
 func (c *Client) Close() error {
-	return c.conn.Close()
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.cancel()
+		if dropped := c.Dropped(); dropped > 0 {
+			log.Printf("Client %s closed with %d dropped messages", c.GetName(), dropped)
+		}
+		err = c.conn.Close()
+	})
+	return err
 }
@@ -0,0 +1,64 @@
+package chat
+
+import (
+	"time"
+)
+
+// HistoryMessage is an original message kept in a room's history, along with
+// the translations that were delivered for it
+type HistoryMessage struct {
+	SenderID     string
+	SenderName   string
+	Language     string
+	Text         string
+	Translations map[string]string // keyed by target language
+	Timestamp    time.Time
+}
+
+// history is a fixed-size ring buffer of recent messages
+type history struct {
+	messages []HistoryMessage
+	next     int // index the next message is written to
+	count    int
+	maxAge   time.Duration
+}
+
+func newHistory(size int, maxAge time.Duration) *history {
+	if size < 0 {
+		size = 0
+	}
+	return &history{
+		messages: make([]HistoryMessage, size),
+		maxAge:   maxAge,
+	}
+}
+
+// add appends a message, overwriting the oldest one when the buffer is full
+func (h *history) add(msg HistoryMessage) {
+	if len(h.messages) == 0 {
+		return
+	}
+	h.messages[h.next] = msg
+	h.next = (h.next + 1) % len(h.messages)
+	if h.count < len(h.messages) {
+		h.count++
+	}
+}
+
+// recent returns the buffered messages that are younger than maxAge, oldest first
+func (h *history) recent(now time.Time) []HistoryMessage {
+	if h.count == 0 {
+		return nil
+	}
+
+	result := make([]HistoryMessage, 0, h.count)
+	start := (h.next - h.count + len(h.messages)) % len(h.messages)
+	for i := 0; i < h.count; i++ {
+		msg := h.messages[(start+i)%len(h.messages)]
+		if h.maxAge > 0 && now.Sub(msg.Timestamp) > h.maxAge {
+			continue
+		}
+		result = append(result, msg)
+	}
+	return result
+}
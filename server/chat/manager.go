@@ -2,37 +2,145 @@ package chat
 
 import (
 	"log"
+	"strings"
 	"sync"
+	"time"
 )
 
+// RoomManagerOptions configures room lifecycle management
+type RoomManagerOptions struct {
+	// EmptyRoomGrace is how long an empty room is kept so that reconnecting
+	// clients find it again; zero removes rooms as soon as the last client leaves
+	EmptyRoomGrace time.Duration
+	// SweepInterval is how often empty rooms past their grace period are
+	// expired; zero disables the sweeper
+	SweepInterval time.Duration
+	// Room configures the rooms created by the manager
+	Room RoomOptions
+}
+
 // RoomManager manages chat rooms
 type RoomManager struct {
 	rooms map[string]*Room
+	opts  RoomManagerOptions
 	mu    sync.RWMutex
+	stop  chan struct{}
+	once  sync.Once
 }
 
 // NewRoomManager creates a new room manager
 func NewRoomManager() *RoomManager {
-	return &RoomManager{
+	return NewRoomManagerWithOptions(RoomManagerOptions{
+		Room: DefaultRoomOptions(),
+	})
+}
+
+// NewRoomManagerWithOptions creates a new room manager and starts its sweeper
+// if one is configured
+func NewRoomManagerWithOptions(opts RoomManagerOptions) *RoomManager {
+	m := &RoomManager{
 		rooms: make(map[string]*Room),
+		opts:  opts,
+		stop:  make(chan struct{}),
+	}
+	if opts.SweepInterval > 0 {
+		go m.sweepLoop()
 	}
+	return m
 }
 
 // GetOrCreateRoom returns an existing room or creates a new one
 func (m *RoomManager) GetOrCreateRoom(id string) *Room {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	return m.getOrCreateRoomLocked(id)
+}
 
+func (m *RoomManager) getOrCreateRoomLocked(id string) *Room {
 	if room, exists := m.rooms[id]; exists {
 		return room
 	}
 
 	log.Printf("🏠 Creating new room: %s", id)
-	room := NewRoom(id)
+	room := NewRoomWithOptions(id, m.opts.Room)
 	m.rooms[id] = room
 	return room
 }
 
+// JoinRoom adds a client to a room, creating the room if needed. The client
+// is added while the manager lock is held so a concurrent removal can never
+// delete the room out from under it.
+func (m *RoomManager) JoinRoom(id string, client *Client) *Room {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	room := m.getOrCreateRoomLocked(id)
+	room.AddClient(client)
+	return room
+}
+
+// LeaveRoom removes a client from a room and removes the room once it has
+// been empty for the configured grace period
+func (m *RoomManager) LeaveRoom(room *Room, client *Client) {
+	room.RemoveClient(client)
+	if !room.IsEmpty() {
+		return
+	}
+
+	if m.opts.EmptyRoomGrace <= 0 {
+		m.removeIfExpired(room)
+		return
+	}
+	time.AfterFunc(m.opts.EmptyRoomGrace, func() {
+		m.removeIfExpired(room)
+	})
+}
+
+// removeIfExpired removes the room if it is still registered and has been
+// empty for at least the grace period
+func (m *RoomManager) removeIfExpired(room *Room) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.rooms[room.GetID()] != room || !room.IsEmpty() {
+		return
+	}
+	if room.EmptyFor() < m.opts.EmptyRoomGrace {
+		return
+	}
+	log.Printf("🏚️  Destroying room: %s", room.GetID())
+	delete(m.rooms, room.GetID())
+}
+
+// sweepLoop periodically expires empty rooms until the manager is stopped
+func (m *RoomManager) sweepLoop() {
+	ticker := time.NewTicker(m.opts.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.sweep()
+		}
+	}
+}
+
+// sweep removes every room that has been empty for longer than the grace period
+func (m *RoomManager) sweep() {
+	for _, room := range m.GetRooms() {
+		m.removeIfExpired(room)
+	}
+}
+
+// Stop stops the room sweeper
+func (m *RoomManager) Stop() {
+	m.once.Do(func() {
+		close(m.stop)
+	})
+}
+
 // RemoveRoom removes a room if it exists and is empty
 func (m *RoomManager) RemoveRoom(id string) {
 	m.mu.Lock()
@@ -51,6 +159,21 @@ func (m *RoomManager) GetRoom(id string) *Room {
 	return m.rooms[id]
 }
 
+// IsParticipant reports whether a client with the given email is currently
+// in the room
+func (m *RoomManager) IsParticipant(roomID, email string) bool {
+	room := m.GetRoom(roomID)
+	if room == nil || email == "" {
+		return false
+	}
+	for _, c := range room.GetClients() {
+		if strings.EqualFold(c.GetEmail(), email) {
+			return true
+		}
+	}
+	return false
+}
+
 // GetRoomCount returns the number of active rooms
 func (m *RoomManager) GetRoomCount() int {
 	m.mu.RLock()
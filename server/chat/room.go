@@ -3,20 +3,54 @@ package chat
 import (
 	"log"
 	"sync"
+	"time"
 )
 
+// RoomOptions configures a room's message history and defaults
+type RoomOptions struct {
+	// HistorySize is the number of recent messages kept for late joiners;
+	// zero disables history
+	HistorySize int
+	// HistoryMaxAge is how long a message stays in history; zero keeps
+	// messages until they are pushed out by newer ones
+	HistoryMaxAge time.Duration
+	// Formality is the register used for clients without a formality of
+	// their own: formal, informal or auto
+	Formality string
+}
+
+// DefaultRoomOptions returns the options used by NewRoom
+func DefaultRoomOptions() RoomOptions {
+	return RoomOptions{
+		HistorySize:   50,
+		HistoryMaxAge: 30 * time.Minute,
+		Formality:     "auto",
+	}
+}
+
 // Room represents a chat room
 type Room struct {
-	id       string
-	clients  map[*Client]bool
-	mu       sync.RWMutex
+	id         string
+	clients    map[*Client]bool
+	emptySince time.Time // zero while the room has clients
+	history    *history
+	formality  string
+	mu         sync.RWMutex
 }
 
-// NewRoom creates a new chat room
+// NewRoom creates a new chat room with the default options
 func NewRoom(id string) *Room {
+	return NewRoomWithOptions(id, DefaultRoomOptions())
+}
+
+// NewRoomWithOptions creates a new chat room
+func NewRoomWithOptions(id string, opts RoomOptions) *Room {
 	return &Room{
-		id:      id,
-		clients: make(map[*Client]bool),
+		id:         id,
+		clients:    make(map[*Client]bool),
+		emptySince: time.Now(),
+		history:    newHistory(opts.HistorySize, opts.HistoryMaxAge),
+		formality:  opts.Formality,
 	}
 }
 
@@ -25,6 +59,7 @@ func (r *Room) AddClient(client *Client) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.clients[client] = true
+	r.emptySince = time.Time{}
 	log.Printf("Client %s joined room %s", client.GetName(), r.id)
 }
 
@@ -33,6 +68,9 @@ func (r *Room) RemoveClient(client *Client) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	delete(r.clients, client)
+	if len(r.clients) == 0 && r.emptySince.IsZero() {
+		r.emptySince = time.Now()
+	}
 	log.Printf("Client %s left room %s", client.GetName(), r.id)
 }
 
@@ -47,12 +85,10 @@ func (r *Room) GetClients() []*Client {
 	return clients
 }
 
-// BroadcastMessage sends a message to all clients in the room
+// BroadcastMessage sends a message to all clients in the room. The handler runs
+// against a snapshot of the room so the lock is not held while it executes.
 func (r *Room) BroadcastMessage(messageHandler func(*Client) error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	for client := range r.clients {
+	for _, client := range r.GetClients() {
 		if err := messageHandler(client); err != nil {
 			log.Printf("Error sending message to client %s: %v", client.GetName(), err)
 		}
@@ -77,3 +113,42 @@ func (r *Room) IsEmpty() bool {
 	defer r.mu.RUnlock()
 	return len(r.clients) == 0
 }
+
+// EmptyFor returns how long the room has had no clients, or zero if it has any
+func (r *Room) EmptyFor() time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.clients) > 0 {
+		return 0
+	}
+	return time.Since(r.emptySince)
+}
+
+// GetFormality returns the room's default formality
+func (r *Room) GetFormality() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.formality
+}
+
+// SetFormality sets the room's default formality
+func (r *Room) SetFormality(formality string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.formality = formality
+}
+
+// AddToHistory records a message for replay to late joiners and as context
+// for later translations
+func (r *Room) AddToHistory(msg HistoryMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.history.add(msg)
+}
+
+// GetHistory returns the room's recent messages, oldest first
+func (r *Room) GetHistory() []HistoryMessage {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.history.recent(time.Now())
+}
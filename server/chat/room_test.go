@@ -1,9 +1,12 @@
 package chat
 
 import (
+	"errors"
 	"github.com/gorilla/websocket"
 	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -79,6 +82,9 @@ func TestRoomManager(t *testing.T) {
 
 	// Verify room exists
 	assert.Equal(t, 1, manager.GetRoomCount())
+	assert.True(t, manager.IsParticipant("test-room", "User@example.com"))
+	assert.False(t, manager.IsParticipant("test-room", "other@example.com"))
+	assert.False(t, manager.IsParticipant("other-room", "user@example.com"))
 
 	// Get the same room again
 	sameRoom := manager.GetOrCreateRoom("test-room")
@@ -93,3 +99,184 @@ func TestRoomManager(t *testing.T) {
 	// Verify room was removed
 	assert.Equal(t, 0, manager.GetRoomCount())
 }
+
+func TestRoomManager_LeaveRoomRemovesEmptyRoom(t *testing.T) {
+	manager := NewRoomManager()
+
+	client1 := NewClient(&websocket.Conn{}, "Test User 1", "user1@example.com")
+	client2 := NewClient(&websocket.Conn{}, "Test User 2", "user2@example.com")
+	room := manager.JoinRoom("test-room", client1)
+	assert.Equal(t, room, manager.JoinRoom("test-room", client2))
+
+	// The room survives while anyone is still in it
+	manager.LeaveRoom(room, client1)
+	assert.Equal(t, 1, manager.GetRoomCount())
+
+	manager.LeaveRoom(room, client2)
+	assert.Equal(t, 0, manager.GetRoomCount())
+}
+
+func TestRoomManager_EmptyRoomGrace(t *testing.T) {
+	manager := NewRoomManagerWithOptions(RoomManagerOptions{EmptyRoomGrace: 50 * time.Millisecond})
+
+	client := NewClient(&websocket.Conn{}, "Test User", "user@example.com")
+	room := manager.JoinRoom("test-room", client)
+	manager.LeaveRoom(room, client)
+
+	// A client reconnecting within the grace period gets the same room back
+	reconnected := NewClient(&websocket.Conn{}, "Test User", "user@example.com")
+	assert.Equal(t, room, manager.JoinRoom("test-room", reconnected))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, manager.GetRoomCount())
+
+	// Once everyone has left the room is removed after the grace period
+	manager.LeaveRoom(room, reconnected)
+	assert.Equal(t, 1, manager.GetRoomCount())
+	assert.Eventually(t, func() bool { return manager.GetRoomCount() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestRoomManager_Sweeper(t *testing.T) {
+	manager := NewRoomManagerWithOptions(RoomManagerOptions{
+		EmptyRoomGrace: 20 * time.Millisecond,
+		SweepInterval:  10 * time.Millisecond,
+	})
+	defer manager.Stop()
+
+	// Rooms that never had a client are expired by the sweeper
+	manager.GetOrCreateRoom("idle-room")
+	occupied := manager.JoinRoom("occupied-room", NewClient(&websocket.Conn{}, "Test User", "user@example.com"))
+
+	assert.Eventually(t, func() bool { return manager.GetRoomCount() == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, occupied, manager.GetRoom("occupied-room"))
+}
+
+func TestRoomHistory(t *testing.T) {
+	room := NewRoomWithOptions("test-room", RoomOptions{HistorySize: 3, HistoryMaxAge: time.Minute})
+	assert.Empty(t, room.GetHistory())
+
+	now := time.Now()
+	room.AddToHistory(HistoryMessage{Text: "stale", Timestamp: now.Add(-2 * time.Minute)})
+	for _, text := range []string{"one", "two", "three", "four"} {
+		room.AddToHistory(HistoryMessage{Text: text, Timestamp: now})
+	}
+
+	// The buffer keeps the newest messages in order and skips expired ones
+	var texts []string
+	for _, msg := range room.GetHistory() {
+		texts = append(texts, msg.Text)
+	}
+	assert.Equal(t, []string{"two", "three", "four"}, texts)
+
+	disabled := NewRoomWithOptions("no-history", RoomOptions{})
+	disabled.AddToHistory(HistoryMessage{Text: "one", Timestamp: now})
+	assert.Empty(t, disabled.GetHistory())
+}
+
+// blockingConn is a clientConn whose writes block until released
+type blockingConn struct {
+	mu      sync.Mutex
+	written []interface{}
+	release chan struct{}
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func newBlockingConn() *blockingConn {
+	return &blockingConn{release: make(chan struct{}), closed: make(chan struct{})}
+}
+
+func (b *blockingConn) WriteJSON(v interface{}) error {
+	<-b.release
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.written = append(b.written, v)
+	return nil
+}
+
+func (b *blockingConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	return nil
+}
+
+func (b *blockingConn) SetReadDeadline(t time.Time) error   { return nil }
+func (b *blockingConn) SetWriteDeadline(t time.Time) error  { return nil }
+func (b *blockingConn) SetPongHandler(h func(string) error) {}
+
+func (b *blockingConn) ReadMessage() (int, []byte, error) {
+	<-b.closed
+	return 0, nil, errors.New("closed")
+}
+
+func (b *blockingConn) Close() error {
+	b.once.Do(func() { close(b.closed) })
+	return nil
+}
+
+func (b *blockingConn) messages() []interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]interface{}(nil), b.written...)
+}
+
+// fillQueue sends messages until the write pump is stuck and the queue is full
+func fillQueue(t *testing.T, client *Client, size int) {
+	// The first message is taken by the write pump, which then blocks
+	assert.NoError(t, client.Send(0))
+	assert.Eventually(t, func() bool { return len(client.send) == 0 }, time.Second, time.Millisecond)
+	for i := 1; i <= size; i++ {
+		assert.NoError(t, client.Send(i))
+	}
+}
+
+func TestClientOverflowPolicies(t *testing.T) {
+	t.Run("drop newest", func(t *testing.T) {
+		conn := newBlockingConn()
+		client := newClient(conn, "Test User", "user@example.com", ClientOptions{SendQueueSize: 2, OverflowPolicy: DropNewest})
+		defer client.Close()
+
+		fillQueue(t, client, 2)
+		assert.ErrorIs(t, client.Send(3), ErrSendQueueFull)
+		assert.Equal(t, uint64(1), client.Dropped())
+
+		close(conn.release)
+		assert.Eventually(t, func() bool { return len(conn.messages()) == 3 }, time.Second, time.Millisecond)
+		assert.Equal(t, []interface{}{0, 1, 2}, conn.messages())
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		conn := newBlockingConn()
+		client := newClient(conn, "Test User", "user@example.com", ClientOptions{SendQueueSize: 2, OverflowPolicy: DropOldest})
+		defer client.Close()
+
+		fillQueue(t, client, 2)
+		assert.NoError(t, client.Send(3))
+		assert.Equal(t, uint64(1), client.Dropped())
+
+		close(conn.release)
+		assert.Eventually(t, func() bool { return len(conn.messages()) == 3 }, time.Second, time.Millisecond)
+		assert.Equal(t, []interface{}{0, 2, 3}, conn.messages())
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		conn := newBlockingConn()
+		client := newClient(conn, "Test User", "user@example.com", ClientOptions{SendQueueSize: 2, OverflowPolicy: Disconnect})
+
+		fillQueue(t, client, 2)
+		assert.ErrorIs(t, client.Send(3), ErrSlowConsumer)
+		assert.ErrorIs(t, client.Send(4), ErrClientClosed)
+
+		_, _, err := client.ReadMessage()
+		assert.Error(t, err)
+		close(conn.release)
+	})
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	for _, p := range []OverflowPolicy{DropOldest, DropNewest, Disconnect} {
+		parsed, err := ParseOverflowPolicy(p.String())
+		assert.NoError(t, err)
+		assert.Equal(t, p, parsed)
+	}
+
+	_, err := ParseOverflowPolicy("bogus")
+	assert.Error(t, err)
+}
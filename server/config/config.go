@@ -4,12 +4,36 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	OpenAIApiKey  string
-	Server        ServerConfig
-	OAuth         OAuthConfig
+	OpenAIApiKey string
+	// OpenAIBaseURL points at an OpenAI-compatible server; empty uses OpenAI
+	OpenAIBaseURL string
+	// OpenAIModel overrides the default chat model
+	OpenAIModel string
+	// OpenAITemperature and OpenAIMaxTokens are sent with every completion
+	OpenAITemperature float32
+	OpenAIMaxTokens   int
+	// OpenAISystemPrompt and OpenAIUserPrompt are Go templates overriding
+	// the default prompts; empty uses the defaults
+	OpenAISystemPrompt string
+	OpenAIUserPrompt   string
+	Server             ServerConfig
+	OAuth              OAuthConfig
+	Client             ClientConfig
+	Heartbeat          HeartbeatConfig
+	Rooms              RoomConfig
+	Transcripts        TranscriptConfig
+	Glossaries         GlossaryConfig
+	Translation        TranslationConfig
+	Providers          ProvidersConfig
+	Usage              UsageConfig
+	Quotas             QuotaConfig
+	// AdminEmails lists the users allowed to use the /admin endpoints
+	AdminEmails []string
 }
 
 type ServerConfig struct {
@@ -23,16 +47,190 @@ type OAuthConfig struct {
 	RedirectURL  string
 }
 
+// ClientConfig controls per-client outbound message queues
+type ClientConfig struct {
+	SendQueueSize  int
+	OverflowPolicy string // drop_oldest, drop_newest or disconnect
+}
+
+// HeartbeatConfig controls WebSocket ping/pong liveness checks
+type HeartbeatConfig struct {
+	PingInterval time.Duration
+	PongWait     time.Duration
+	WriteWait    time.Duration
+}
+
+// RoomConfig controls room lifetime and message history
+type RoomConfig struct {
+	EmptyRoomGrace time.Duration
+	SweepInterval  time.Duration
+	HistorySize    int
+	HistoryMaxAge  time.Duration
+	// Formality is the default register of new rooms: formal, informal or auto
+	Formality string
+}
+
+// TranscriptConfig controls where meeting transcripts are stored
+type TranscriptConfig struct {
+	Dir string // empty disables transcripts
+}
+
+// GlossaryConfig controls where glossaries are stored
+type GlossaryConfig struct {
+	File string // empty keeps glossaries in memory only
+}
+
+// UsageConfig controls token usage accounting
+type UsageConfig struct {
+	File          string // empty keeps usage in memory only
+	FlushInterval time.Duration
+	// Prices overrides model prices as comma-separated
+	// model=prompt/completion entries in dollars per million tokens
+	Prices string
+}
+
+// QuotaConfig holds translation quotas per user and email domain; zero
+// limits are unlimited
+type QuotaConfig struct {
+	Unit          string // chars or tokens
+	UserDaily     int
+	UserMonthly   int
+	DomainDaily   int
+	DomainMonthly int
+	// Overrides sets the limits of particular users or domains as
+	// comma-separated key=daily/monthly entries
+	Overrides string
+	// File keeps the counts across restarts; empty keeps them in memory only
+	File         string
+	SaveInterval time.Duration
+}
+
+// TranslationConfig controls how messages are translated
+type TranslationConfig struct {
+	// Providers lists the translation providers to try, in order
+	Providers []string
+	// ProviderTimeout bounds each provider's attempt before falling back to
+	// the next one; it defaults to an equal share of Timeout, and zero, only
+	// allowed with a single provider, lets it use the whole Timeout
+	ProviderTimeout time.Duration
+	// ContextTurns is how many recent messages are sent as conversation
+	// context; zero disables context-aware translation
+	ContextTurns int
+	// ContextTokenBudget bounds the estimated size of that context
+	ContextTokenBudget int
+	// Timeout bounds each translation call
+	Timeout time.Duration
+	// MaxRetries, RetryBaseDelay and RetryMaxDelay control retries of
+	// transient provider failures
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// CircuitFailureThreshold consecutive failures open the circuit breaker
+	// for CircuitOpenDuration; a threshold of zero disables it
+	CircuitFailureThreshold int
+	CircuitOpenDuration     time.Duration
+	// Streaming shows translations while they are produced, sending updates
+	// at most every DeltaInterval
+	Streaming     bool
+	DeltaInterval time.Duration
+	// MultiTarget translates a message into all of a room's languages with
+	// one request where the provider supports it
+	MultiTarget bool
+	// InterimInterval is how often interim transcripts are translated while
+	// a sentence is being spoken; zero disables interim translation
+	InterimInterval time.Duration
+	// MaxConcurrent bounds the translation calls in flight in each room
+	MaxConcurrent int
+	// Detector is the language detector used to find the language each
+	// message is written in: none, ngram or openai
+	Detector string
+	// DetectionThreshold is the confidence a detection needs to override
+	// the sender's preferred language
+	DetectionThreshold float64
+	// CacheSize is the number of cached translations; zero disables the cache
+	CacheSize int
+	CacheTTL  time.Duration
+	// CacheFile persists the cache across restarts; empty disables persistence
+	CacheFile string
+}
+
+// ProvidersConfig holds credentials and endpoints of translation providers
+// other than OpenAI
+type ProvidersConfig struct {
+	DeepL          ProviderConfig
+	Google         ProviderConfig
+	LibreTranslate ProviderConfig
+	Azure          ProviderConfig
+}
+
+// ProviderConfig holds a translation provider's credentials and endpoint
+type ProviderConfig struct {
+	APIKey string
+	URL    string
+	Region string // Azure only
+}
+
+// providerNames are the translation providers TRANSLATION_PROVIDERS accepts
+var providerNames = map[string]bool{
+	"openai":         true,
+	"deepl":          true,
+	"google":         true,
+	"libretranslate": true,
+	"azure":          true,
+}
+
 // LoadConfig loads configuration from environment variables
 func LoadConfig() (*Config, error) {
 	config := &Config{}
 
 	// Required variables
+	config.Translation.Providers = getEnvList("TRANSLATION_PROVIDERS", []string{"openai"})
+	if len(config.Translation.Providers) == 0 {
+		return nil, fmt.Errorf("TRANSLATION_PROVIDERS lists no provider")
+	}
+	for _, name := range config.Translation.Providers {
+		if !providerNames[name] {
+			return nil, fmt.Errorf("unknown translation provider %q in TRANSLATION_PROVIDERS", name)
+		}
+	}
+
+	// Self-hosted OpenAI-compatible servers usually do not need a key
 	config.OpenAIApiKey = os.Getenv("OPENAI_API_KEY")
-	if config.OpenAIApiKey == "" {
+	config.OpenAIBaseURL = os.Getenv("OPENAI_BASE_URL")
+	config.OpenAIModel = os.Getenv("OPENAI_MODEL")
+	if config.OpenAIApiKey == "" && config.OpenAIBaseURL == "" &&
+		(config.usesProvider("openai") || os.Getenv("LANGUAGE_DETECTOR") == "openai") {
 		return nil, fmt.Errorf("OPENAI_API_KEY environment variable is required")
 	}
 
+	config.OpenAISystemPrompt = os.Getenv("OPENAI_SYSTEM_PROMPT")
+	config.OpenAIUserPrompt = os.Getenv("OPENAI_USER_PROMPT")
+
+	config.Providers.DeepL.APIKey = os.Getenv("DEEPL_API_KEY")
+	config.Providers.DeepL.URL = os.Getenv("DEEPL_URL")
+	if config.Providers.DeepL.APIKey == "" && config.usesProvider("deepl") {
+		return nil, fmt.Errorf("DEEPL_API_KEY environment variable is required")
+	}
+
+	config.Providers.Google.APIKey = os.Getenv("GOOGLE_TRANSLATE_API_KEY")
+	config.Providers.Google.URL = os.Getenv("GOOGLE_TRANSLATE_URL")
+	if config.Providers.Google.APIKey == "" && config.usesProvider("google") {
+		return nil, fmt.Errorf("GOOGLE_TRANSLATE_API_KEY environment variable is required")
+	}
+
+	config.Providers.LibreTranslate.APIKey = os.Getenv("LIBRETRANSLATE_API_KEY")
+	config.Providers.LibreTranslate.URL = os.Getenv("LIBRETRANSLATE_URL")
+	if config.Providers.LibreTranslate.URL == "" && config.usesProvider("libretranslate") {
+		return nil, fmt.Errorf("LIBRETRANSLATE_URL environment variable is required")
+	}
+
+	config.Providers.Azure.APIKey = os.Getenv("AZURE_TRANSLATOR_KEY")
+	config.Providers.Azure.URL = os.Getenv("AZURE_TRANSLATOR_ENDPOINT")
+	config.Providers.Azure.Region = os.Getenv("AZURE_TRANSLATOR_REGION")
+	if config.Providers.Azure.APIKey == "" && config.usesProvider("azure") {
+		return nil, fmt.Errorf("AZURE_TRANSLATOR_KEY environment variable is required")
+	}
+
 	config.OAuth.ClientID = os.Getenv("GOOGLE_CLIENT_ID")
 	if config.OAuth.ClientID == "" {
 		return nil, fmt.Errorf("GOOGLE_CLIENT_ID environment variable is required")
@@ -65,5 +263,258 @@ func LoadConfig() (*Config, error) {
 		config.Server.Port = port
 	}
 
+	temperature, err := getEnvFloat("OPENAI_TEMPERATURE", 0)
+	if err != nil {
+		return nil, err
+	}
+	if temperature < 0 || temperature > 2 {
+		return nil, fmt.Errorf("OPENAI_TEMPERATURE must be between 0 and 2")
+	}
+	config.OpenAITemperature = float32(temperature)
+	if config.OpenAIMaxTokens, err = getEnvInt("OPENAI_MAX_TOKENS", 1000); err != nil {
+		return nil, err
+	}
+
+	queueSize, err := getEnvInt("SEND_QUEUE_SIZE", 64)
+	if err != nil {
+		return nil, err
+	}
+	config.Client.SendQueueSize = queueSize
+
+	config.Client.OverflowPolicy = os.Getenv("SEND_OVERFLOW_POLICY")
+	if config.Client.OverflowPolicy == "" {
+		config.Client.OverflowPolicy = "drop_oldest"
+	}
+
+	if config.Heartbeat.PingInterval, err = getEnvDuration("PING_INTERVAL", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if config.Heartbeat.PongWait, err = getEnvDuration("PONG_WAIT", 60*time.Second); err != nil {
+		return nil, err
+	}
+	if config.Heartbeat.WriteWait, err = getEnvDuration("WRITE_WAIT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	// Without pings, peers that only listen would be disconnected
+	if config.Heartbeat.PongWait > 0 && config.Heartbeat.PingInterval <= 0 {
+		return nil, fmt.Errorf("PONG_WAIT requires PING_INTERVAL; set both to 0 to disable the heartbeat")
+	}
+	if config.Heartbeat.PongWait > 0 && config.Heartbeat.PingInterval >= config.Heartbeat.PongWait {
+		return nil, fmt.Errorf("PING_INTERVAL must be shorter than PONG_WAIT")
+	}
+
+	if config.Rooms.EmptyRoomGrace, err = getEnvDuration("ROOM_EMPTY_GRACE", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if config.Rooms.SweepInterval, err = getEnvDuration("ROOM_SWEEP_INTERVAL", time.Minute); err != nil {
+		return nil, err
+	}
+	if config.Rooms.HistorySize, err = getEnvInt("HISTORY_SIZE", 50); err != nil {
+		return nil, err
+	}
+	if config.Rooms.HistoryMaxAge, err = getEnvDuration("HISTORY_MAX_AGE", 30*time.Minute); err != nil {
+		return nil, err
+	}
+	config.Rooms.Formality = strings.ToLower(os.Getenv("DEFAULT_FORMALITY"))
+	switch config.Rooms.Formality {
+	case "":
+		config.Rooms.Formality = "auto"
+	case "auto", "formal", "informal":
+	default:
+		return nil, fmt.Errorf("invalid DEFAULT_FORMALITY value: %s", config.Rooms.Formality)
+	}
+
+	config.Transcripts.Dir = os.Getenv("TRANSCRIPT_DIR")
+	config.Glossaries.File = os.Getenv("GLOSSARY_FILE")
+
+	if config.Translation.ContextTurns, err = getEnvInt("CONTEXT_TURNS", 0); err != nil {
+		return nil, err
+	}
+	if config.Translation.ContextTokenBudget, err = getEnvInt("CONTEXT_TOKEN_BUDGET", 1000); err != nil {
+		return nil, err
+	}
+	if config.Translation.Timeout, err = getEnvDuration("TRANSLATION_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	// By default each provider gets an equal share of the deadline, so a
+	// hanging provider leaves time for the next one
+	providerTimeout := config.Translation.Timeout / time.Duration(len(config.Translation.Providers))
+	if config.Translation.ProviderTimeout, err = getEnvDuration("TRANSLATION_PROVIDER_TIMEOUT", providerTimeout); err != nil {
+		return nil, err
+	}
+	if config.Translation.ProviderTimeout <= 0 && len(config.Translation.Providers) > 1 {
+		return nil, fmt.Errorf("TRANSLATION_PROVIDER_TIMEOUT must be positive when several providers are configured")
+	}
+	if config.Translation.MaxRetries, err = getEnvInt("TRANSLATION_MAX_RETRIES", 2); err != nil {
+		return nil, err
+	}
+	if config.Translation.RetryBaseDelay, err = getEnvDuration("TRANSLATION_RETRY_BASE_DELAY", 200*time.Millisecond); err != nil {
+		return nil, err
+	}
+	if config.Translation.RetryMaxDelay, err = getEnvDuration("TRANSLATION_RETRY_MAX_DELAY", 5*time.Second); err != nil {
+		return nil, err
+	}
+	if config.Translation.CircuitFailureThreshold, err = getEnvInt("CIRCUIT_FAILURE_THRESHOLD", 5); err != nil {
+		return nil, err
+	}
+	if config.Translation.CircuitOpenDuration, err = getEnvDuration("CIRCUIT_OPEN_DURATION", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if config.Translation.Streaming, err = getEnvBool("STREAM_TRANSLATIONS", false); err != nil {
+		return nil, err
+	}
+	if config.Translation.DeltaInterval, err = getEnvDuration("STREAM_DELTA_INTERVAL", 100*time.Millisecond); err != nil {
+		return nil, err
+	}
+	if config.Translation.MultiTarget, err = getEnvBool("MULTI_TARGET_TRANSLATION", true); err != nil {
+		return nil, err
+	}
+	if config.Translation.InterimInterval, err = getEnvDuration("INTERIM_INTERVAL", 500*time.Millisecond); err != nil {
+		return nil, err
+	}
+	if config.Translation.MaxConcurrent, err = getEnvInt("MAX_CONCURRENT_TRANSLATIONS", 8); err != nil {
+		return nil, err
+	}
+	if config.Translation.MaxConcurrent < 1 {
+		return nil, fmt.Errorf("MAX_CONCURRENT_TRANSLATIONS must be at least 1")
+	}
+	config.Translation.Detector = strings.ToLower(os.Getenv("LANGUAGE_DETECTOR"))
+	switch config.Translation.Detector {
+	case "":
+		config.Translation.Detector = "ngram"
+	case "none", "ngram", "openai":
+	default:
+		return nil, fmt.Errorf("invalid LANGUAGE_DETECTOR value: %s", config.Translation.Detector)
+	}
+	if config.Translation.DetectionThreshold, err = getEnvFloat("LANGUAGE_DETECTION_THRESHOLD", 0.6); err != nil {
+		return nil, err
+	}
+	if config.Translation.CacheSize, err = getEnvInt("TRANSLATION_CACHE_SIZE", 10000); err != nil {
+		return nil, err
+	}
+	if config.Translation.CacheTTL, err = getEnvDuration("TRANSLATION_CACHE_TTL", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	config.Translation.CacheFile = os.Getenv("TRANSLATION_CACHE_FILE")
+
+	config.Usage.File = os.Getenv("USAGE_FILE")
+	if config.Usage.FlushInterval, err = getEnvDuration("USAGE_FLUSH_INTERVAL", time.Minute); err != nil {
+		return nil, err
+	}
+	config.Usage.Prices = os.Getenv("USAGE_PRICES")
+	config.AdminEmails = getEnvList("ADMIN_EMAILS", nil)
+
+	config.Quotas.Unit = strings.ToLower(os.Getenv("QUOTA_UNIT"))
+	switch config.Quotas.Unit {
+	case "":
+		config.Quotas.Unit = "chars"
+	case "chars", "tokens":
+	default:
+		return nil, fmt.Errorf("invalid QUOTA_UNIT value: %s", config.Quotas.Unit)
+	}
+	// Only the OpenAI translator reports tokens, so token quotas would never
+	// be reached without it
+	if config.Quotas.Unit == "tokens" && !config.usesProvider("openai") {
+		return nil, fmt.Errorf("QUOTA_UNIT=tokens requires the openai translation provider")
+	}
+	if config.Quotas.UserDaily, err = getEnvInt("QUOTA_USER_DAILY", 0); err != nil {
+		return nil, err
+	}
+	if config.Quotas.UserMonthly, err = getEnvInt("QUOTA_USER_MONTHLY", 0); err != nil {
+		return nil, err
+	}
+	if config.Quotas.DomainDaily, err = getEnvInt("QUOTA_DOMAIN_DAILY", 0); err != nil {
+		return nil, err
+	}
+	if config.Quotas.DomainMonthly, err = getEnvInt("QUOTA_DOMAIN_MONTHLY", 0); err != nil {
+		return nil, err
+	}
+	config.Quotas.Overrides = os.Getenv("QUOTA_OVERRIDES")
+	config.Quotas.File = os.Getenv("QUOTA_FILE")
+	if config.Quotas.SaveInterval, err = getEnvDuration("QUOTA_SAVE_INTERVAL", time.Minute); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
+
+// usesProvider reports whether the named translation provider is enabled
+func (c *Config) usesProvider(name string) bool {
+	for _, provider := range c.Translation.Providers {
+		if provider == name {
+			return true
+		}
+	}
+	return false
+}
+
+// getEnvList reads a comma-separated, case-insensitive list environment
+// variable, returning def if it is unset
+func getEnvList(key string, def []string) []string {
+	str := os.Getenv(key)
+	if str == "" {
+		return def
+	}
+	var values []string
+	for _, value := range strings.Split(str, ",") {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvInt reads an integer environment variable, returning def if it is unset
+func getEnvInt(key string, def int) (int, error) {
+	str := os.Getenv(key)
+	if str == "" {
+		return def, nil
+	}
+	value, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value: %v", key, err)
+	}
+	return value, nil
+}
+
+// getEnvBool reads a boolean environment variable such as "true" or "0",
+// returning def if it is unset
+func getEnvBool(key string, def bool) (bool, error) {
+	str := os.Getenv(key)
+	if str == "" {
+		return def, nil
+	}
+	value, err := strconv.ParseBool(str)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s value: %v", key, err)
+	}
+	return value, nil
+}
+
+// getEnvFloat reads a floating point environment variable, returning def if
+// it is unset
+func getEnvFloat(key string, def float64) (float64, error) {
+	str := os.Getenv(key)
+	if str == "" {
+		return def, nil
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value: %v", key, err)
+	}
+	return value, nil
+}
+
+// getEnvDuration reads a duration environment variable such as "30s",
+// returning def if it is unset
+func getEnvDuration(key string, def time.Duration) (time.Duration, error) {
+	str := os.Getenv(key)
+	if str == "" {
+		return def, nil
+	}
+	value, err := time.ParseDuration(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value: %v", key, err)
+	}
+	return value, nil
+}
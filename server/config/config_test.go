@@ -0,0 +1,90 @@
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"shabe/server/translate"
+)
+
+// setRequiredEnv sets the variables LoadConfig cannot do without
+func setRequiredEnv(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	t.Setenv("GOOGLE_CLIENT_ID", "client-id")
+	t.Setenv("GOOGLE_CLIENT_SECRET", "client-secret")
+	t.Setenv("OAUTH_REDIRECT_URL", "http://localhost:8080/auth/callback")
+}
+
+// hangingTranslator never answers before its context is done
+type hangingTranslator struct{}
+
+func (hangingTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+// echoTranslator answers at once
+type echoTranslator struct{}
+
+func (echoTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	return "[" + toLang + "] " + text, nil
+}
+
+func TestLoadConfig_ProviderTimeout(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("TRANSLATION_TIMEOUT", "200ms")
+
+	// A single provider may use the whole deadline
+	cfg, err := LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, 200*time.Millisecond, cfg.Translation.ProviderTimeout)
+
+	// Several providers share it, so a hanging provider leaves time for the
+	// next one
+	t.Setenv("TRANSLATION_PROVIDERS", "openai,deepl")
+	t.Setenv("DEEPL_API_KEY", "deepl-key")
+	cfg, err = LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, 100*time.Millisecond, cfg.Translation.ProviderTimeout)
+
+	f := translate.NewFallbackTranslator(cfg.Translation.ProviderTimeout,
+		translate.Provider{Name: "openai", Translator: hangingTranslator{}},
+		translate.Provider{Name: "deepl", Translator: echoTranslator{}},
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Translation.Timeout)
+	defer cancel()
+	translated, err := f.Translate(ctx, "hello", "en", "ja")
+	assert.NoError(t, err)
+	assert.Equal(t, "[ja] hello", translated)
+
+	// Without a per-provider timeout the first provider would never be left
+	t.Setenv("TRANSLATION_PROVIDER_TIMEOUT", "0s")
+	_, err = LoadConfig()
+	assert.Error(t, err)
+}
+
+func TestLoadConfig_Heartbeat(t *testing.T) {
+	setRequiredEnv(t)
+
+	cfg, err := LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, cfg.Heartbeat.PingInterval)
+	assert.Equal(t, 60*time.Second, cfg.Heartbeat.PongWait)
+
+	// Listen-only peers would be disconnected without pings
+	t.Setenv("PING_INTERVAL", "0s")
+	_, err = LoadConfig()
+	assert.Error(t, err)
+
+	t.Setenv("PONG_WAIT", "0s")
+	cfg, err = LoadConfig()
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.Heartbeat.PongWait)
+
+	t.Setenv("PING_INTERVAL", "1m")
+	t.Setenv("PONG_WAIT", "30s")
+	_, err = LoadConfig()
+	assert.Error(t, err)
+}
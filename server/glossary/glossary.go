@@ -0,0 +1,150 @@
+package glossary
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Term forces how a phrase is translated
+type Term struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	// FromLang and ToLang restrict the term to a language pair; empty
+	// matches any language
+	FromLang string `json:"fromLang,omitempty"`
+	ToLang   string `json:"toLang,omitempty"`
+}
+
+// Glossary holds forced term mappings and terms that must never be translated,
+// such as product and people's names
+type Glossary struct {
+	Terms          []Term   `json:"terms"`
+	DoNotTranslate []string `json:"doNotTranslate"`
+}
+
+// IsEmpty reports whether the glossary has no entries
+func (g Glossary) IsEmpty() bool {
+	return len(g.Terms) == 0 && len(g.DoNotTranslate) == 0
+}
+
+// Limits on glossary contents, which end up in translation prompts
+const (
+	MaxTerms      = 500 // terms and do-not-translate entries together
+	MaxTermLength = 100 // characters per source, target or entry
+)
+
+// Validate checks that every entry is usable and within the limits
+func (g Glossary) Validate() error {
+	if n := len(g.Terms) + len(g.DoNotTranslate); n > MaxTerms {
+		return fmt.Errorf("%d entries, at most %d are allowed", n, MaxTerms)
+	}
+	for i, t := range g.Terms {
+		if strings.TrimSpace(t.Source) == "" || strings.TrimSpace(t.Target) == "" {
+			return fmt.Errorf("term %d: source and target are required", i)
+		}
+		if utf8.RuneCountInString(t.Source) > MaxTermLength || utf8.RuneCountInString(t.Target) > MaxTermLength {
+			return fmt.Errorf("term %d: longer than %d characters", i, MaxTermLength)
+		}
+	}
+	for i, term := range g.DoNotTranslate {
+		if strings.TrimSpace(term) == "" {
+			return fmt.Errorf("doNotTranslate %d: term is empty", i)
+		}
+		if utf8.RuneCountInString(term) > MaxTermLength {
+			return fmt.Errorf("doNotTranslate %d: longer than %d characters", i, MaxTermLength)
+		}
+	}
+	return nil
+}
+
+// For returns the entries that apply when translating from fromLang to toLang
+func (g Glossary) For(fromLang, toLang string) Glossary {
+	var result Glossary
+	for _, t := range g.Terms {
+		if matchLang(t.FromLang, fromLang) && matchLang(t.ToLang, toLang) {
+			result.Terms = append(result.Terms, t)
+		}
+	}
+	result.DoNotTranslate = g.DoNotTranslate
+	return result
+}
+
+// Fingerprint identifies the glossary's contents, so translations made with
+// different glossaries are not confused. It is empty for an empty glossary.
+func (g Glossary) Fingerprint() string {
+	if g.IsEmpty() {
+		return ""
+	}
+	data, _ := json.Marshal(g)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Merge combines the org-wide glossary with a room's glossary. Room terms
+// replace org terms with the same source and language pair.
+func Merge(org, room Glossary) Glossary {
+	if org.IsEmpty() {
+		return room
+	}
+	if room.IsEmpty() {
+		return org
+	}
+
+	var merged Glossary
+	overridden := make(map[Term]bool)
+	for _, t := range room.Terms {
+		overridden[termKey(t)] = true
+	}
+	for _, t := range org.Terms {
+		if !overridden[termKey(t)] {
+			merged.Terms = append(merged.Terms, t)
+		}
+	}
+	merged.Terms = append(merged.Terms, room.Terms...)
+
+	seen := make(map[string]bool)
+	for _, term := range append(append([]string{}, org.DoNotTranslate...), room.DoNotTranslate...) {
+		if key := strings.ToLower(term); !seen[key] {
+			seen[key] = true
+			merged.DoNotTranslate = append(merged.DoNotTranslate, term)
+		}
+	}
+	return merged
+}
+
+// termKey identifies which term an entry defines, ignoring its target
+func termKey(t Term) Term {
+	return Term{
+		Source:   strings.ToLower(t.Source),
+		FromLang: strings.ToLower(t.FromLang),
+		ToLang:   strings.ToLower(t.ToLang),
+	}
+}
+
+// matchLang reports whether a term's language restriction matches lang. A
+// restriction to a base language such as "pt" also matches "pt-BR".
+func matchLang(want, lang string) bool {
+	if want == "" || strings.EqualFold(want, lang) {
+		return true
+	}
+	base, _, _ := strings.Cut(lang, "-")
+	return strings.EqualFold(want, base)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the glossary to translate with
+func NewContext(ctx context.Context, g Glossary) context.Context {
+	return context.WithValue(ctx, contextKey{}, g)
+}
+
+// FromContext returns the glossary carried by ctx, if any
+func FromContext(ctx context.Context) Glossary {
+	g, _ := ctx.Value(contextKey{}).(Glossary)
+	return g
+}
@@ -0,0 +1,163 @@
+package glossary
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"shabe/server/auth"
+)
+
+// roomMembers maps room IDs to the emails of their participants
+type roomMembers map[string][]string
+
+func (m roomMembers) IsParticipant(roomID, email string) bool {
+	for _, member := range m[roomID] {
+		if member == email {
+			return true
+		}
+	}
+	return false
+}
+
+func TestGlossary_For(t *testing.T) {
+	g := Glossary{
+		Terms: []Term{
+			{Source: "Shabe", Target: "シャベ", FromLang: "en", ToLang: "ja"},
+			{Source: "standup", Target: "daily"},
+			{Source: "meeting", Target: "reunião", ToLang: "pt"},
+		},
+		DoNotTranslate: []string{"Kubernetes"},
+	}
+
+	ja := g.For("en", "ja")
+	assert.Len(t, ja.Terms, 2)
+	assert.Equal(t, []string{"Kubernetes"}, ja.DoNotTranslate)
+
+	// A base language restriction matches regional variants
+	pt := g.For("en", "pt-BR")
+	assert.Equal(t, []Term{g.Terms[1], g.Terms[2]}, pt.Terms)
+
+	assert.Empty(t, Glossary{}.Fingerprint())
+	assert.NotEqual(t, ja.Fingerprint(), pt.Fingerprint())
+}
+
+func TestGlossary_Validate(t *testing.T) {
+	assert.NoError(t, Glossary{Terms: []Term{{Source: "a", Target: "b"}}}.Validate())
+	assert.Error(t, Glossary{Terms: []Term{{Source: "a"}}}.Validate())
+	assert.Error(t, Glossary{DoNotTranslate: []string{" "}}.Validate())
+}
+
+func TestMerge(t *testing.T) {
+	org := Glossary{
+		Terms:          []Term{{Source: "Shabe", Target: "org"}, {Source: "OKR", Target: "objectives"}},
+		DoNotTranslate: []string{"Kubernetes"},
+	}
+	room := Glossary{
+		Terms:          []Term{{Source: "shabe", Target: "room"}},
+		DoNotTranslate: []string{"kubernetes", "Alice"},
+	}
+
+	merged := Merge(org, room)
+	assert.Equal(t, []Term{{Source: "OKR", Target: "objectives"}, {Source: "shabe", Target: "room"}}, merged.Terms)
+	assert.Equal(t, []string{"Kubernetes", "Alice"}, merged.DoNotTranslate)
+
+	assert.Equal(t, org, Merge(org, Glossary{}))
+	assert.Equal(t, room, Merge(Glossary{}, room))
+}
+
+func TestContext(t *testing.T) {
+	assert.True(t, FromContext(context.Background()).IsEmpty())
+	g := Glossary{DoNotTranslate: []string{"Alice"}}
+	assert.Equal(t, g, FromContext(NewContext(context.Background(), g)))
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "glossaries.json")
+	store, err := NewFileStore(path)
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.Put(Org, Glossary{DoNotTranslate: []string{"Kubernetes"}}))
+	assert.NoError(t, store.Put("room-1", Glossary{Terms: []Term{{Source: "Shabe", Target: "シャベ"}}}))
+	assert.NoError(t, store.Put("room-2", Glossary{DoNotTranslate: []string{"Alice"}}))
+	assert.NoError(t, store.Delete("room-2"))
+
+	reopened, err := NewFileStore(path)
+	assert.NoError(t, err)
+	resolved, err := Resolve(reopened, "room-1")
+	assert.NoError(t, err)
+	assert.Equal(t, Glossary{
+		Terms:          []Term{{Source: "Shabe", Target: "シャベ"}},
+		DoNotTranslate: []string{"Kubernetes"},
+	}, resolved)
+
+	g, err := reopened.Get("room-2")
+	assert.NoError(t, err)
+	assert.True(t, g.IsEmpty())
+}
+
+func TestHandler(t *testing.T) {
+	store := NewMemoryStore()
+	h := NewHandler(store, []string{"admin@example.com"}, roomMembers{"abc": {"alice@example.com"}})
+	router := mux.NewRouter()
+	for _, path := range []string{"/glossary", "/rooms/{id}/glossary"} {
+		router.HandleFunc(path, h.HandleGet).Methods("GET")
+		router.HandleFunc(path, h.HandlePut).Methods("PUT")
+		router.HandleFunc(path, h.HandleDelete).Methods("DELETE")
+	}
+
+	as := func(email, method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if email != "" {
+			req = req.WithContext(auth.NewContext(req.Context(), &auth.UserInfo{Email: email}))
+		}
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		return as("admin@example.com", method, path, body)
+	}
+
+	rec := as("bob@example.com", "GET", "/rooms/abc/glossary", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"terms":[],"doNotTranslate":[]}`, rec.Body.String())
+
+	// Only the room's participants and admins may change its glossary, and
+	// only admins the org-wide one
+	body := `{"terms":[{"source":"Shabe","target":"シャベ","toLang":"ja"}]}`
+	assert.Equal(t, http.StatusUnauthorized, as("", "PUT", "/rooms/abc/glossary", body).Code)
+	assert.Equal(t, http.StatusForbidden, as("bob@example.com", "PUT", "/rooms/abc/glossary", body).Code)
+	assert.Equal(t, http.StatusForbidden, as("alice@example.com", "PUT", "/rooms/other/glossary", body).Code)
+	assert.Equal(t, http.StatusForbidden, as("alice@example.com", "PUT", "/glossary", body).Code)
+	g, _ := store.Get("other")
+	assert.True(t, g.IsEmpty())
+
+	rec = as("alice@example.com", "PUT", "/rooms/abc/glossary", body)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	g, _ = store.Get("abc")
+	assert.Equal(t, []Term{{Source: "Shabe", Target: "シャベ", ToLang: "ja"}}, g.Terms)
+
+	rec = do("PUT", "/glossary", `{"doNotTranslate":["Kubernetes"]}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	g, _ = store.Get(Org)
+	assert.Equal(t, []string{"Kubernetes"}, g.DoNotTranslate)
+
+	assert.Equal(t, http.StatusBadRequest, do("PUT", "/glossary", `{"terms":[{"source":"x"}]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("PUT", "/glossary", `not json`).Code)
+
+	// Glossaries are limited in size
+	long := strings.Repeat("x", MaxTermLength+1)
+	assert.Equal(t, http.StatusBadRequest, do("PUT", "/glossary", `{"doNotTranslate":["`+long+`"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("PUT", "/glossary", `{"doNotTranslate":["x"`+strings.Repeat(`,"x"`, MaxTerms)+`]}`).Code)
+
+	assert.Equal(t, http.StatusForbidden, as("bob@example.com", "DELETE", "/rooms/abc/glossary", "").Code)
+	assert.Equal(t, http.StatusNoContent, as("alice@example.com", "DELETE", "/rooms/abc/glossary", "").Code)
+	g, _ = store.Get("abc")
+	assert.True(t, g.IsEmpty())
+}
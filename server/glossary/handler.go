@@ -0,0 +1,117 @@
+package glossary
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"shabe/server/auth"
+
+	"github.com/gorilla/mux"
+)
+
+// maxGlossarySize bounds the size of an uploaded glossary
+const maxGlossarySize = 1 << 20
+
+// Participants tells whether a user is currently in a room
+type Participants interface {
+	IsParticipant(roomID, email string) bool
+}
+
+// Handler manages glossaries over HTTP. Routes with an {id} variable act on
+// that room's glossary; routes without one act on the org-wide glossary.
+// Anyone signed in may read glossaries, but only admins may change the
+// org-wide glossary, and only admins and the room's current participants a
+// room's glossary.
+type Handler struct {
+	store        Store
+	admins       []string
+	participants Participants
+}
+
+// NewHandler creates a new glossary Handler
+func NewHandler(store Store, admins []string, participants Participants) *Handler {
+	return &Handler{store: store, admins: admins, participants: participants}
+}
+
+// canWrite checks that the user in the request context may change the
+// glossary of scope, writing an error response if not
+func (h *Handler) canWrite(w http.ResponseWriter, r *http.Request, scope string) bool {
+	user := auth.FromContext(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if auth.IsAdmin(h.admins, user.Email) {
+		return true
+	}
+	if scope != Org && h.participants != nil && h.participants.IsParticipant(scope, user.Email) {
+		return true
+	}
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return false
+}
+
+// HandleGet handles GET /glossary and GET /rooms/{id}/glossary
+func (h *Handler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	scope := mux.Vars(r)["id"]
+	g, err := h.store.Get(scope)
+	if err != nil {
+		log.Printf("Error loading glossary %q: %v", scope, err)
+		http.Error(w, "Failed to load glossary", http.StatusInternalServerError)
+		return
+	}
+	writeGlossary(w, g)
+}
+
+// HandlePut handles PUT /glossary and PUT /rooms/{id}/glossary, replacing the
+// whole glossary
+func (h *Handler) HandlePut(w http.ResponseWriter, r *http.Request) {
+	scope := mux.Vars(r)["id"]
+	if !h.canWrite(w, r, scope) {
+		return
+	}
+
+	var g Glossary
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGlossarySize)).Decode(&g); err != nil {
+		http.Error(w, "Invalid glossary: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := g.Validate(); err != nil {
+		http.Error(w, "Invalid glossary: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store.Put(scope, g); err != nil {
+		log.Printf("Error saving glossary %q: %v", scope, err)
+		http.Error(w, "Failed to save glossary", http.StatusInternalServerError)
+		return
+	}
+	writeGlossary(w, g)
+}
+
+// HandleDelete handles DELETE /glossary and DELETE /rooms/{id}/glossary
+func (h *Handler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	scope := mux.Vars(r)["id"]
+	if !h.canWrite(w, r, scope) {
+		return
+	}
+	if err := h.store.Delete(scope); err != nil {
+		log.Printf("Error deleting glossary %q: %v", scope, err)
+		http.Error(w, "Failed to delete glossary", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeGlossary writes g as JSON, with empty lists rather than null
+func writeGlossary(w http.ResponseWriter, g Glossary) {
+	if g.Terms == nil {
+		g.Terms = []Term{}
+	}
+	if g.DoNotTranslate == nil {
+		g.DoNotTranslate = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(g)
+}
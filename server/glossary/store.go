@@ -0,0 +1,136 @@
+package glossary
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Org is the scope of the org-wide glossary that applies to every room
+const Org = ""
+
+// Store keeps glossaries by scope: a room ID, or Org for the org-wide default
+type Store interface {
+	// Get returns the scope's glossary, or an empty one if none is set
+	Get(scope string) (Glossary, error)
+	Put(scope string, g Glossary) error
+	Delete(scope string) error
+}
+
+// Resolve returns the glossary that applies in a room: the org-wide glossary
+// merged with the room's own
+func Resolve(store Store, roomID string) (Glossary, error) {
+	org, err := store.Get(Org)
+	if err != nil {
+		return Glossary{}, err
+	}
+	room, err := store.Get(roomID)
+	if err != nil {
+		return Glossary{}, err
+	}
+	return Merge(org, room), nil
+}
+
+// MemoryStore is a Store that keeps glossaries in memory
+type MemoryStore struct {
+	mu         sync.RWMutex
+	glossaries map[string]Glossary
+}
+
+// NewMemoryStore creates a new MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		glossaries: make(map[string]Glossary),
+	}
+}
+
+// Get returns the scope's glossary
+func (s *MemoryStore) Get(scope string) (Glossary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.glossaries[scope], nil
+}
+
+// Put replaces the scope's glossary
+func (s *MemoryStore) Put(scope string, g Glossary) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.glossaries[scope] = g
+	return nil
+}
+
+// Delete removes the scope's glossary
+func (s *MemoryStore) Delete(scope string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.glossaries, scope)
+	return nil
+}
+
+// FileStore is a Store that keeps glossaries in memory and writes them all to
+// a JSON file whenever they change
+type FileStore struct {
+	*MemoryStore
+	path string
+	mu   sync.Mutex // serialises writes to the file
+}
+
+// NewFileStore creates a FileStore backed by path, loading any glossaries
+// saved there
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading glossaries: %v", err)
+	}
+	if err := json.Unmarshal(data, &s.glossaries); err != nil {
+		return nil, fmt.Errorf("error parsing glossaries: %v", err)
+	}
+	return s, nil
+}
+
+// Put replaces the scope's glossary and saves the file
+func (s *FileStore) Put(scope string, g Glossary) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.MemoryStore.Put(scope, g)
+	return s.save()
+}
+
+// Delete removes the scope's glossary and saves the file
+func (s *FileStore) Delete(scope string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.MemoryStore.Delete(scope)
+	return s.save()
+}
+
+// save writes all glossaries to a temporary file and renames it into place
+func (s *FileStore) save() error {
+	s.MemoryStore.mu.RLock()
+	data, err := json.MarshalIndent(s.glossaries, "", "  ")
+	s.MemoryStore.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("error encoding glossaries: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".glossaries-*")
+	if err != nil {
+		return fmt.Errorf("error saving glossaries: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error saving glossaries: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error saving glossaries: %v", err)
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
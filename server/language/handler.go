@@ -0,0 +1,65 @@
+package language
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// listTTL is how long a successfully fetched language list is reused
+const listTTL = time.Hour
+
+// Source reports the language tags a translator can translate into
+type Source interface {
+	Languages(ctx context.Context) ([]string, error)
+}
+
+// Handler serves the languages the configured translator supports
+type Handler struct {
+	source Source
+
+	mu        sync.Mutex
+	cached    []Language
+	fetchedAt time.Time
+}
+
+// NewHandler creates a new language Handler
+func NewHandler(source Source) *Handler {
+	return &Handler{source: source}
+}
+
+// HandleList handles GET /languages
+func (h *Handler) HandleList(w http.ResponseWriter, r *http.Request) {
+	list, err := h.list(r.Context())
+	if err != nil {
+		log.Printf("Error listing languages: %v", err)
+		http.Error(w, "Failed to list languages", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		log.Printf("Error writing languages: %v", err)
+	}
+}
+
+// list returns the supported languages, asking the source at most once per
+// listTTL
+func (h *Handler) list(ctx context.Context) ([]Language, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cached != nil && time.Since(h.fetchedAt) < listTTL {
+		return h.cached, nil
+	}
+
+	tags, err := h.source.Languages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	h.cached = List(tags)
+	h.fetchedAt = time.Now()
+	return h.cached, nil
+}
@@ -0,0 +1,134 @@
+// Package language parses, normalizes and names BCP-47 language tags.
+package language
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Language is a language tag with its English display name
+type Language struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// Parse validates a BCP-47 tag made of a language subtag optionally followed
+// by a script and a region, such as ja, ja-JP, zh-Hant or pt-BR, and returns
+// it in canonical form. Underscores are accepted as separators, deprecated
+// language codes are replaced, and unknown subtags are rejected.
+func Parse(tag string) (string, error) {
+	subtags := strings.Split(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"), "-")
+	if len(subtags) > 3 {
+		return "", fmt.Errorf("unsupported language tag %q", tag)
+	}
+
+	lang := strings.ToLower(subtags[0])
+	if replacement, ok := deprecated[lang]; ok {
+		lang = replacement
+	}
+	if _, ok := languages[lang]; !ok {
+		return "", fmt.Errorf("unknown language %q", tag)
+	}
+
+	result := lang
+	script, region := "", ""
+	for _, subtag := range subtags[1:] {
+		switch {
+		case len(subtag) == 4 && script == "" && region == "":
+			script = strings.ToUpper(subtag[:1]) + strings.ToLower(subtag[1:])
+			if _, ok := scripts[script]; !ok {
+				return "", fmt.Errorf("unknown script in language tag %q", tag)
+			}
+			result += "-" + script
+		case (len(subtag) == 2 || len(subtag) == 3) && region == "":
+			region = strings.ToUpper(subtag)
+			if _, ok := regions[region]; !ok {
+				return "", fmt.Errorf("unknown region in language tag %q", tag)
+			}
+			result += "-" + region
+		default:
+			return "", fmt.Errorf("unsupported language tag %q", tag)
+		}
+	}
+	return result, nil
+}
+
+// Base returns the language subtag of tag, e.g. pt for pt-BR
+func Base(tag string) string {
+	base, _, _ := strings.Cut(tag, "-")
+	return strings.ToLower(base)
+}
+
+// Script returns the script tag is written in: its script subtag, or the one
+// implied for Chinese, such as Hant for zh-TW and Hans for zh. It is empty
+// when tag does not determine a script.
+func Script(tag string) string {
+	subtags := strings.Split(strings.ReplaceAll(tag, "_", "-"), "-")
+	for _, subtag := range subtags[1:] {
+		if len(subtag) == 4 {
+			return strings.ToUpper(subtag[:1]) + strings.ToLower(subtag[1:])
+		}
+	}
+	if strings.ToLower(subtags[0]) != "zh" {
+		return ""
+	}
+	for _, subtag := range subtags[1:] {
+		switch strings.ToUpper(subtag) {
+		case "TW", "HK", "MO":
+			return "Hant"
+		}
+	}
+	return "Hans"
+}
+
+// Name returns the English display name of tag, e.g. "Portuguese (Brazil)"
+// or "Chinese (Traditional)". Tags that do not parse are returned unchanged.
+func Name(tag string) string {
+	canonical, err := Parse(tag)
+	if err != nil {
+		return tag
+	}
+
+	subtags := strings.Split(canonical, "-")
+	name := languages[subtags[0]]
+	var qualifiers []string
+	for _, subtag := range subtags[1:] {
+		if len(subtag) == 4 {
+			qualifiers = append(qualifiers, scripts[subtag])
+		} else {
+			qualifiers = append(qualifiers, regions[subtag])
+		}
+	}
+	if len(qualifiers) > 0 {
+		name += " (" + strings.Join(qualifiers, ", ") + ")"
+	}
+	return name
+}
+
+// All returns every known language, without script or region, sorted by code
+func All() []Language {
+	result := make([]Language, 0, len(languages))
+	for code, name := range languages {
+		result = append(result, Language{Code: code, Name: name})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Code < result[j].Code })
+	return result
+}
+
+// List returns the given tags with their display names, sorted by code.
+// Tags that do not parse are dropped and duplicates are removed.
+func List(tags []string) []Language {
+	seen := make(map[string]bool, len(tags))
+	result := make([]Language, 0, len(tags))
+	for _, tag := range tags {
+		canonical, err := Parse(tag)
+		if err != nil || seen[canonical] {
+			continue
+		}
+		seen[canonical] = true
+		result = append(result, Language{Code: canonical, Name: Name(canonical)})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Code < result[j].Code })
+	return result
+}
@@ -0,0 +1,102 @@
+package language
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"ja", "ja"},
+		{"JA", "ja"},
+		{"ja-jp", "ja-JP"},
+		{"zh-hant", "zh-Hant"},
+		{"zh-Hant-TW", "zh-Hant-TW"},
+		{"pt_br", "pt-BR"},
+		{"es-419", "es-419"},
+		{"iw", "he"},
+		{" fil ", "fil"},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.tag)
+		assert.NoError(t, err, tt.tag)
+		assert.Equal(t, tt.want, got, tt.tag)
+	}
+
+	for _, tag := range []string{"", "xx", "english", "ja-XX", "zh-Abcd", "ja-JP-JP", "en-US-x-private", "ja--JP"} {
+		_, err := Parse(tag)
+		assert.Error(t, err, tag)
+	}
+}
+
+func TestScript(t *testing.T) {
+	assert.Equal(t, "Hant", Script("zh-Hant"))
+	assert.Equal(t, "Hant", Script("zh-TW"))
+	assert.Equal(t, "Hans", Script("zh"))
+	assert.Equal(t, "Hans", Script("zh-Hans-HK"))
+	assert.Equal(t, "Latn", Script("sr-latn"))
+	assert.Empty(t, Script("en-GB"))
+}
+
+func TestName(t *testing.T) {
+	assert.Equal(t, "Japanese", Name("ja"))
+	assert.Equal(t, "Portuguese (Brazil)", Name("pt-br"))
+	assert.Equal(t, "Chinese (Traditional)", Name("zh-Hant"))
+	assert.Equal(t, "Chinese (Simplified, China)", Name("zh-Hans-CN"))
+	assert.Equal(t, "klingon", Name("klingon"))
+	assert.Equal(t, "pt", Base("pt-BR"))
+}
+
+func TestList(t *testing.T) {
+	assert.Equal(t, []Language{
+		{Code: "en-US", Name: "English (United States)"},
+		{Code: "ja", Name: "Japanese"},
+		{Code: "zh-Hans", Name: "Chinese (Simplified)"},
+	}, List([]string{"ZH-HANS", "ja", "mni-Mtei", "EN-US", "ja"}))
+
+	all := All()
+	assert.Contains(t, all, Language{Code: "en", Name: "English"})
+	assert.Equal(t, "af", all[0].Code)
+}
+
+// stubSource returns canned languages, counting calls
+type stubSource struct {
+	tags  []string
+	err   error
+	calls int
+}
+
+func (s *stubSource) Languages(ctx context.Context) ([]string, error) {
+	s.calls++
+	return s.tags, s.err
+}
+
+func TestHandler(t *testing.T) {
+	source := &stubSource{tags: []string{"ja", "pt-BR"}}
+	h := NewHandler(source)
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h.HandleList(w, httptest.NewRequest(http.MethodGet, "/languages", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var list []Language
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+		assert.Equal(t, []Language{{Code: "ja", Name: "Japanese"}, {Code: "pt-BR", Name: "Portuguese (Brazil)"}}, list)
+	}
+	// The list is fetched once and reused
+	assert.Equal(t, 1, source.calls)
+
+	w := httptest.NewRecorder()
+	NewHandler(&stubSource{err: errors.New("unreachable")}).HandleList(w, httptest.NewRequest(http.MethodGet, "/languages", nil))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+}
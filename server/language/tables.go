@@ -0,0 +1,228 @@
+package language
+
+// languages maps the language subtags translation services commonly support
+// to their English names
+var languages = map[string]string{
+	"af":  "Afrikaans",
+	"am":  "Amharic",
+	"ar":  "Arabic",
+	"as":  "Assamese",
+	"az":  "Azerbaijani",
+	"ba":  "Bashkir",
+	"be":  "Belarusian",
+	"bg":  "Bulgarian",
+	"bn":  "Bengali",
+	"bo":  "Tibetan",
+	"bs":  "Bosnian",
+	"ca":  "Catalan",
+	"ceb": "Cebuano",
+	"co":  "Corsican",
+	"cs":  "Czech",
+	"cy":  "Welsh",
+	"da":  "Danish",
+	"de":  "German",
+	"dv":  "Divehi",
+	"el":  "Greek",
+	"en":  "English",
+	"eo":  "Esperanto",
+	"es":  "Spanish",
+	"et":  "Estonian",
+	"eu":  "Basque",
+	"fa":  "Persian",
+	"fi":  "Finnish",
+	"fil": "Filipino",
+	"fj":  "Fijian",
+	"fo":  "Faroese",
+	"fr":  "French",
+	"fy":  "Western Frisian",
+	"ga":  "Irish",
+	"gd":  "Scottish Gaelic",
+	"gl":  "Galician",
+	"gu":  "Gujarati",
+	"ha":  "Hausa",
+	"haw": "Hawaiian",
+	"he":  "Hebrew",
+	"hi":  "Hindi",
+	"hmn": "Hmong",
+	"hr":  "Croatian",
+	"ht":  "Haitian Creole",
+	"hu":  "Hungarian",
+	"hy":  "Armenian",
+	"id":  "Indonesian",
+	"ig":  "Igbo",
+	"is":  "Icelandic",
+	"it":  "Italian",
+	"iu":  "Inuktitut",
+	"ja":  "Japanese",
+	"jv":  "Javanese",
+	"ka":  "Georgian",
+	"kk":  "Kazakh",
+	"km":  "Khmer",
+	"kn":  "Kannada",
+	"ko":  "Korean",
+	"ku":  "Kurdish",
+	"ky":  "Kyrgyz",
+	"la":  "Latin",
+	"lb":  "Luxembourgish",
+	"lo":  "Lao",
+	"lt":  "Lithuanian",
+	"lv":  "Latvian",
+	"mg":  "Malagasy",
+	"mi":  "Maori",
+	"mk":  "Macedonian",
+	"ml":  "Malayalam",
+	"mn":  "Mongolian",
+	"mr":  "Marathi",
+	"ms":  "Malay",
+	"mt":  "Maltese",
+	"my":  "Burmese",
+	"nb":  "Norwegian Bokmål",
+	"ne":  "Nepali",
+	"nl":  "Dutch",
+	"nn":  "Norwegian Nynorsk",
+	"no":  "Norwegian",
+	"ny":  "Chichewa",
+	"or":  "Odia",
+	"pa":  "Punjabi",
+	"pl":  "Polish",
+	"ps":  "Pashto",
+	"pt":  "Portuguese",
+	"ro":  "Romanian",
+	"ru":  "Russian",
+	"rw":  "Kinyarwanda",
+	"sd":  "Sindhi",
+	"si":  "Sinhala",
+	"sk":  "Slovak",
+	"sl":  "Slovenian",
+	"sm":  "Samoan",
+	"sn":  "Shona",
+	"so":  "Somali",
+	"sq":  "Albanian",
+	"sr":  "Serbian",
+	"st":  "Southern Sotho",
+	"su":  "Sundanese",
+	"sv":  "Swedish",
+	"sw":  "Swahili",
+	"ta":  "Tamil",
+	"te":  "Telugu",
+	"tg":  "Tajik",
+	"th":  "Thai",
+	"ti":  "Tigrinya",
+	"tk":  "Turkmen",
+	"tl":  "Tagalog",
+	"to":  "Tongan",
+	"tr":  "Turkish",
+	"tt":  "Tatar",
+	"ty":  "Tahitian",
+	"ug":  "Uyghur",
+	"uk":  "Ukrainian",
+	"ur":  "Urdu",
+	"uz":  "Uzbek",
+	"vi":  "Vietnamese",
+	"xh":  "Xhosa",
+	"yi":  "Yiddish",
+	"yo":  "Yoruba",
+	"yue": "Cantonese",
+	"zh":  "Chinese",
+	"zu":  "Zulu",
+}
+
+// deprecated maps withdrawn language subtags, still sent by some browsers
+// and providers, to their replacements
+var deprecated = map[string]string{
+	"in": "id",
+	"iw": "he",
+	"ji": "yi",
+	"jw": "jv",
+}
+
+// scripts maps the script subtags in use for the languages above to their
+// English names
+var scripts = map[string]string{
+	"Arab": "Arabic",
+	"Beng": "Bengali",
+	"Cyrl": "Cyrillic",
+	"Deva": "Devanagari",
+	"Guru": "Gurmukhi",
+	"Hans": "Simplified",
+	"Hant": "Traditional",
+	"Latn": "Latin",
+	"Mong": "Mongolian",
+	"Tibt": "Tibetan",
+}
+
+// regions maps region subtags to their English names
+var regions = map[string]string{
+	"419": "Latin America",
+	"AE":  "United Arab Emirates",
+	"AR":  "Argentina",
+	"AT":  "Austria",
+	"AU":  "Australia",
+	"BE":  "Belgium",
+	"BO":  "Bolivia",
+	"BR":  "Brazil",
+	"CA":  "Canada",
+	"CH":  "Switzerland",
+	"CL":  "Chile",
+	"CN":  "China",
+	"CO":  "Colombia",
+	"CR":  "Costa Rica",
+	"CU":  "Cuba",
+	"DE":  "Germany",
+	"DK":  "Denmark",
+	"DO":  "Dominican Republic",
+	"DZ":  "Algeria",
+	"EC":  "Ecuador",
+	"EG":  "Egypt",
+	"ES":  "Spain",
+	"FI":  "Finland",
+	"FR":  "France",
+	"GB":  "United Kingdom",
+	"GT":  "Guatemala",
+	"HK":  "Hong Kong",
+	"HN":  "Honduras",
+	"ID":  "Indonesia",
+	"IE":  "Ireland",
+	"IL":  "Israel",
+	"IN":  "India",
+	"IQ":  "Iraq",
+	"IT":  "Italy",
+	"JO":  "Jordan",
+	"JP":  "Japan",
+	"KE":  "Kenya",
+	"KR":  "South Korea",
+	"KW":  "Kuwait",
+	"LB":  "Lebanon",
+	"LU":  "Luxembourg",
+	"MA":  "Morocco",
+	"MO":  "Macao",
+	"MX":  "Mexico",
+	"MY":  "Malaysia",
+	"NG":  "Nigeria",
+	"NI":  "Nicaragua",
+	"NL":  "Netherlands",
+	"NO":  "Norway",
+	"NZ":  "New Zealand",
+	"PA":  "Panama",
+	"PE":  "Peru",
+	"PH":  "Philippines",
+	"PK":  "Pakistan",
+	"PR":  "Puerto Rico",
+	"PT":  "Portugal",
+	"PY":  "Paraguay",
+	"QA":  "Qatar",
+	"RU":  "Russia",
+	"SA":  "Saudi Arabia",
+	"SE":  "Sweden",
+	"SG":  "Singapore",
+	"SV":  "El Salvador",
+	"TH":  "Thailand",
+	"TN":  "Tunisia",
+	"TW":  "Taiwan",
+	"UA":  "Ukraine",
+	"US":  "United States",
+	"UY":  "Uruguay",
+	"VE":  "Venezuela",
+	"VN":  "Vietnam",
+	"ZA":  "South Africa",
+}
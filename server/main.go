@@ -1,30 +1,199 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	"shabe/server/auth"
 	"shabe/server/chat"
+	"shabe/server/config"
+	"shabe/server/glossary"
+	"shabe/server/language"
+	"shabe/server/quota"
+	"shabe/server/transcript"
 	"shabe/server/translate"
+	"shabe/server/usage"
 	"shabe/server/websocket"
 )
 
 func main() {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	overflowPolicy, err := chat.ParseOverflowPolicy(cfg.Client.OverflowPolicy)
+	if err != nil {
+		log.Fatalf("Invalid SEND_OVERFLOW_POLICY: %v", err)
+	}
+
 	// Initialize components
 	authManager := auth.NewManager(&auth.Config{
-		ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
-		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-		RedirectURL:  os.Getenv("OAUTH_REDIRECT_URL"),
+		ClientID:     cfg.OAuth.ClientID,
+		ClientSecret: cfg.OAuth.ClientSecret,
+		RedirectURL:  cfg.OAuth.RedirectURL,
 	})
 
-	roomManager := chat.NewRoomManager()
+	roomManager := chat.NewRoomManagerWithOptions(chat.RoomManagerOptions{
+		EmptyRoomGrace: cfg.Rooms.EmptyRoomGrace,
+		SweepInterval:  cfg.Rooms.SweepInterval,
+		Room: chat.RoomOptions{
+			HistorySize:   cfg.Rooms.HistorySize,
+			HistoryMaxAge: cfg.Rooms.HistoryMaxAge,
+			Formality:     cfg.Rooms.Formality,
+		},
+	})
+	defer roomManager.Stop()
+
+	prompt, err := translate.ParsePrompt(cfg.OpenAISystemPrompt, cfg.OpenAIUserPrompt)
+	if err != nil {
+		log.Fatalf("Invalid OpenAI prompt: %v", err)
+	}
+
+	prices := usage.DefaultPrices()
+	customPrices, err := usage.ParsePriceTable(cfg.Usage.Prices)
+	if err != nil {
+		log.Fatalf("Invalid USAGE_PRICES: %v", err)
+	}
+	for model, price := range customPrices {
+		prices[model] = price
+	}
+	var usageSink usage.Sink = usage.NewMemorySink()
+	if cfg.Usage.File != "" {
+		fileSink, err := usage.NewFileSink(cfg.Usage.File)
+		if err != nil {
+			log.Fatalf("Failed to open usage file: %v", err)
+		}
+		usageSink = fileSink
+	}
+	usageTracker := usage.NewTracker(usageSink, cfg.Usage.FlushInterval)
+	defer func() {
+		if err := usageTracker.Close(); err != nil {
+			log.Printf("Error saving usage: %v", err)
+		}
+	}()
+
+	// Quotas count OpenAI tokens as they are reported, alongside usage
+	// accounting, or characters as the websocket handler translates them
+	var recorder usage.Recorder = usageTracker
+	quotas, err := newQuotaManager(cfg)
+	if err != nil {
+		log.Fatalf("Invalid quota configuration: %v", err)
+	}
+	if quotas != nil {
+		defer func() {
+			if err := quotas.Close(); err != nil {
+				log.Printf("Error saving quota counts: %v", err)
+			}
+		}()
+		recorder = usage.Recorders{usageTracker, quotas}
+		log.Printf("Translation quotas enabled, counted in %s", cfg.Quotas.Unit)
+		if cfg.Quotas.File == "" {
+			log.Printf("QUOTA_FILE is not set, so quota counts start over when the server restarts")
+		}
+	}
+
+	var providers []translate.Provider
+	for _, name := range cfg.Translation.Providers {
+		providers = append(providers, translate.Provider{Name: name, Translator: newProvider(name, cfg, prompt, recorder)})
+	}
+	var provider translate.Translator = providers[0].Translator
+	if len(providers) > 1 {
+		provider = translate.NewFallbackTranslator(cfg.Translation.ProviderTimeout, providers...)
+	}
+	log.Printf("Translation providers: %v", cfg.Translation.Providers)
 
-	translator := translate.NewOpenAITranslator(os.Getenv("OPENAI_API_KEY"))
+	resilient := translate.NewResilientTranslator(
+		provider,
+		translate.ResilienceOptions{
+			MaxRetries:       cfg.Translation.MaxRetries,
+			BaseDelay:        cfg.Translation.RetryBaseDelay,
+			MaxDelay:         cfg.Translation.RetryMaxDelay,
+			FailureThreshold: cfg.Translation.CircuitFailureThreshold,
+			OpenDuration:     cfg.Translation.CircuitOpenDuration,
+		},
+	)
+	var translator translate.Translator = resilient
 
-	wsHandler := websocket.NewHandler(roomManager, authManager, translator)
+	if cfg.Translation.CacheSize > 0 {
+		cache, err := translate.NewCachingTranslator(translator, translate.CacheOptions{
+			Size:        cfg.Translation.CacheSize,
+			TTL:         cfg.Translation.CacheTTL,
+			PersistPath: cfg.Translation.CacheFile,
+			Fingerprint: cacheFingerprint(cfg),
+		})
+		if err != nil {
+			log.Fatalf("Failed to create translation cache: %v", err)
+		}
+		defer func() {
+			if err := cache.Close(); err != nil {
+				log.Printf("Error saving translation cache: %v", err)
+			}
+		}()
+		translator = cache
+	}
+
+	var transcripts transcript.Store
+	if cfg.Transcripts.Dir != "" {
+		fileStore, err := transcript.NewFileStore(cfg.Transcripts.Dir)
+		if err != nil {
+			log.Fatalf("Failed to open transcript store: %v", err)
+		}
+		defer fileStore.Close()
+		transcripts = fileStore
+		log.Printf("Recording transcripts to %s", cfg.Transcripts.Dir)
+	}
+
+	var glossaries glossary.Store = glossary.NewMemoryStore()
+	if cfg.Glossaries.File != "" {
+		fileStore, err := glossary.NewFileStore(cfg.Glossaries.File)
+		if err != nil {
+			log.Fatalf("Failed to open glossary store: %v", err)
+		}
+		glossaries = fileStore
+	}
+
+	var detector translate.LanguageDetector
+	switch cfg.Translation.Detector {
+	case "ngram":
+		detector = translate.NewNgramDetector()
+	case "openai":
+		detector = newOpenAITranslator(cfg, prompt, recorder)
+	}
+
+	wsHandler := websocket.NewHandlerWithConfig(roomManager, authManager, translator, &websocket.Config{
+		ClientOptions: chat.ClientOptions{
+			SendQueueSize:  cfg.Client.SendQueueSize,
+			OverflowPolicy: overflowPolicy,
+			PingInterval:   cfg.Heartbeat.PingInterval,
+			PongWait:       cfg.Heartbeat.PongWait,
+			WriteWait:      cfg.Heartbeat.WriteWait,
+		},
+		Transcripts:        transcripts,
+		ContextTurns:       cfg.Translation.ContextTurns,
+		Glossaries:         glossaries,
+		Detector:           detector,
+		DetectionThreshold: cfg.Translation.DetectionThreshold,
+		Streaming:          cfg.Translation.Streaming,
+		DeltaInterval:      cfg.Translation.DeltaInterval,
+		MultiTarget:        cfg.Translation.MultiTarget,
+		InterimInterval:    cfg.Translation.InterimInterval,
+		TranslationTimeout: cfg.Translation.Timeout,
+		Quotas:             quotas,
+
+		MaxConcurrentTranslations: cfg.Translation.MaxConcurrent,
+	})
+	resilient.OnStateChange(wsHandler.NotifyTranslationStatus)
 
 	// Set up routes
 	router := mux.NewRouter()
@@ -33,7 +202,7 @@ func main() {
 	router.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "https://meet.google.com")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 			w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type")
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
 
@@ -55,18 +224,148 @@ func main() {
 	// WebSocket route
 	router.HandleFunc("/ws", wsHandler.HandleConnection)
 
+	// Transcript export route
+	if transcripts != nil {
+		transcriptHandler := transcript.NewHandler(transcripts, cfg.AdminEmails)
+		router.Handle("/rooms/{id}/transcript", authManager.AuthMiddleware(http.HandlerFunc(transcriptHandler.HandleExport))).Methods("GET")
+	}
+
+	// Glossary routes; the org-wide glossary applies in every room, so only
+	// admins may change it
+	glossaryHandler := glossary.NewHandler(glossaries, cfg.AdminEmails, roomManager)
+	router.Handle("/glossary", authManager.AuthMiddleware(http.HandlerFunc(glossaryHandler.HandleGet))).Methods("GET")
+	router.Handle("/glossary", authManager.AdminMiddleware(cfg.AdminEmails, http.HandlerFunc(glossaryHandler.HandlePut))).Methods("PUT")
+	router.Handle("/glossary", authManager.AdminMiddleware(cfg.AdminEmails, http.HandlerFunc(glossaryHandler.HandleDelete))).Methods("DELETE")
+	router.Handle("/rooms/{id}/glossary", authManager.AuthMiddleware(http.HandlerFunc(glossaryHandler.HandleGet))).Methods("GET")
+	router.Handle("/rooms/{id}/glossary", authManager.AuthMiddleware(http.HandlerFunc(glossaryHandler.HandlePut))).Methods("PUT")
+	router.Handle("/rooms/{id}/glossary", authManager.AuthMiddleware(http.HandlerFunc(glossaryHandler.HandleDelete))).Methods("DELETE")
+
+	// Supported languages route
+	languageHandler := language.NewHandler(resilient)
+	router.HandleFunc("/languages", languageHandler.HandleList).Methods("GET")
+
+	// Admin routes
+	usageHandler := usage.NewHandler(usageTracker, prices)
+	router.Handle("/admin/usage", authManager.AdminMiddleware(cfg.AdminEmails, http.HandlerFunc(usageHandler.HandleGet))).Methods("GET")
+
 	// Static file server
 	fs := http.FileServer(http.Dir("static"))
 	router.PathPrefix("/").Handler(fs)
 
 	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler: router,
+	}
+	go func() {
+		log.Printf("Server starting on port %d", cfg.Server.Port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// Shut down gracefully so deferred cleanup such as saving the
+	// translation cache runs
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	log.Printf("Server shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
 	}
+}
 
-	log.Printf("Server starting on port %s", port)
-	if err := http.ListenAndServe(":"+port, router); err != nil {
-		log.Fatal(err)
+// newProvider creates the named translation provider from the configuration
+func newProvider(name string, cfg *config.Config, prompt *translate.Prompt, recorder usage.Recorder) translate.Translator {
+	switch name {
+	// Classical MT providers get glossaries enforced by masking; OpenAI is
+	// told about them in its prompt
+	case "deepl":
+		return translate.NewMaskingTranslator(translate.NewDeepLTranslator(translate.DeepLConfig{
+			APIKey:  cfg.Providers.DeepL.APIKey,
+			BaseURL: cfg.Providers.DeepL.URL,
+		}))
+	case "google":
+		return translate.NewMaskingTranslator(translate.NewGoogleTranslator(translate.GoogleConfig{
+			APIKey:  cfg.Providers.Google.APIKey,
+			BaseURL: cfg.Providers.Google.URL,
+		}))
+	case "libretranslate":
+		return translate.NewMaskingTranslator(translate.NewLibreTranslateTranslator(translate.LibreTranslateConfig{
+			URL:    cfg.Providers.LibreTranslate.URL,
+			APIKey: cfg.Providers.LibreTranslate.APIKey,
+		}))
+	case "azure":
+		return translate.NewMaskingTranslator(translate.NewAzureTranslator(translate.AzureConfig{
+			Key:      cfg.Providers.Azure.APIKey,
+			Region:   cfg.Providers.Azure.Region,
+			Endpoint: cfg.Providers.Azure.URL,
+		}))
+	default:
+		return newOpenAITranslator(cfg, prompt, recorder)
+	}
+}
+
+// newOpenAITranslator creates the OpenAI translator from the configuration
+func newOpenAITranslator(cfg *config.Config, prompt *translate.Prompt, recorder usage.Recorder) *translate.OpenAITranslator {
+	return translate.NewOpenAITranslatorWithConfig(translate.OpenAIConfig{
+		APIKey:             cfg.OpenAIApiKey,
+		BaseURL:            cfg.OpenAIBaseURL,
+		Model:              cfg.OpenAIModel,
+		Temperature:        cfg.OpenAITemperature,
+		MaxTokens:          cfg.OpenAIMaxTokens,
+		Prompt:             prompt,
+		ContextTokenBudget: cfg.Translation.ContextTokenBudget,
+		Usage:              recorder,
+	})
+}
+
+// cacheFingerprint identifies the configuration that shapes translations, so
+// a persisted cache is not served after the providers, model or prompts change
+func cacheFingerprint(cfg *config.Config) string {
+	data, _ := json.Marshal(struct {
+		Providers                               []string
+		OpenAIBaseURL, OpenAIModel              string
+		OpenAITemperature                       float32
+		OpenAIMaxTokens                         int
+		OpenAISystemPrompt, OpenAIUserPrompt    string
+		DeepLURL, GoogleURL, LibreURL, AzureURL string
+	}{
+		cfg.Translation.Providers,
+		cfg.OpenAIBaseURL, cfg.OpenAIModel,
+		cfg.OpenAITemperature,
+		cfg.OpenAIMaxTokens,
+		cfg.OpenAISystemPrompt, cfg.OpenAIUserPrompt,
+		cfg.Providers.DeepL.URL, cfg.Providers.Google.URL, cfg.Providers.LibreTranslate.URL, cfg.Providers.Azure.URL,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// newQuotaManager builds the quota manager from the configuration, or returns
+// nil if no quota is set
+func newQuotaManager(cfg *config.Config) (*quota.Manager, error) {
+	unit, err := quota.ParseUnit(cfg.Quotas.Unit)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := quota.ParseLimits(cfg.Quotas.Overrides)
+	if err != nil {
+		return nil, err
+	}
+	quotaConfig := quota.Config{
+		Unit:         unit,
+		User:         quota.Limits{Daily: int64(cfg.Quotas.UserDaily), Monthly: int64(cfg.Quotas.UserMonthly)},
+		Domain:       quota.Limits{Daily: int64(cfg.Quotas.DomainDaily), Monthly: int64(cfg.Quotas.DomainMonthly)},
+		Overrides:    overrides,
+		PersistPath:  cfg.Quotas.File,
+		SaveInterval: cfg.Quotas.SaveInterval,
+	}
+	if !quotaConfig.Enabled() {
+		return nil, nil
 	}
+	return quota.NewManager(quotaConfig)
 }
@@ -8,6 +8,7 @@ import (
 
 	"shabe/server/auth"
 	"shabe/server/chat"
+	"shabe/server/config"
 	"shabe/server/translate"
 	wshandler "shabe/server/websocket"
 
@@ -155,3 +156,25 @@ func TestStaticFileServer(t *testing.T) {
 		}
 	})
 }
+
+func TestCacheFingerprint(t *testing.T) {
+	cfg := &config.Config{OpenAIModel: "gpt-4o-mini"}
+	cfg.Translation.Providers = []string{"openai"}
+	fingerprint := cacheFingerprint(cfg)
+	if fingerprint != cacheFingerprint(cfg) {
+		t.Errorf("Expected the same configuration to have the same fingerprint")
+	}
+
+	changes := map[string]func(c *config.Config){
+		"model":     func(c *config.Config) { c.OpenAIModel = "gpt-4o" },
+		"prompt":    func(c *config.Config) { c.OpenAISystemPrompt = "Translate {{.Text}}" },
+		"providers": func(c *config.Config) { c.Translation.Providers = []string{"deepl", "openai"} },
+	}
+	for name, change := range changes {
+		changed := *cfg
+		change(&changed)
+		if cacheFingerprint(&changed) == fingerprint {
+			t.Errorf("Expected a %s change to change the fingerprint", name)
+		}
+	}
+}
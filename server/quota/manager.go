@@ -0,0 +1,165 @@
+package quota
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"shabe/server/usage"
+)
+
+// counter is the usage of one user or domain in the current day and month
+type counter struct {
+	Day     time.Time `json:"day"`
+	Month   time.Time `json:"month"`
+	Daily   int64     `json:"daily"`
+	Monthly int64     `json:"monthly"`
+}
+
+// roll starts new periods once the day or month of now has begun
+func (c *counter) roll(now time.Time) {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if !c.Day.Equal(day) {
+		c.Day, c.Daily = day, 0
+	}
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if !c.Month.Equal(month) {
+		c.Month, c.Monthly = month, 0
+	}
+}
+
+// Manager counts translation usage per user and email domain and tells
+// whether a quota is used up. With a PersistPath the counts survive
+// restarts, losing at most the usage since the last save on a crash.
+type Manager struct {
+	config  Config
+	now     func() time.Time
+	users   map[string]*counter
+	domains map[string]*counter
+	mu      sync.Mutex
+	saveMu  sync.Mutex // serializes writes to the persistence file
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewManager creates a Manager enforcing cfg, loading the counts saved at
+// cfg.PersistPath and saving them every cfg.SaveInterval
+func NewManager(cfg Config) (*Manager, error) {
+	if cfg.Unit == "" {
+		cfg.Unit = UnitChars
+	}
+	m := &Manager{
+		config:  cfg,
+		now:     time.Now,
+		users:   make(map[string]*counter),
+		domains: make(map[string]*counter),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if cfg.PersistPath != "" {
+		if err := m.load(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.PersistPath != "" && cfg.SaveInterval > 0 {
+		go m.saveLoop(cfg.SaveInterval)
+	} else {
+		close(m.done)
+	}
+	return m, nil
+}
+
+// Check returns an *Exceeded error if the user with the given email, or
+// their email domain, has used up a quota. Users without an email are not
+// limited.
+func (m *Manager) Check(email string) error {
+	email = strings.ToLower(email)
+	if email == "" {
+		return nil
+	}
+	domain := domainOf(email)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now().UTC()
+	if err := m.checkLocked(m.users, ScopeUser, email, m.limits(email, m.config.User), now); err != nil {
+		return err
+	}
+	if domain == "" {
+		return nil
+	}
+	return m.checkLocked(m.domains, ScopeDomain, domain, m.limits(domain, m.config.Domain), now)
+}
+
+// limits returns the limits of a user or domain
+func (m *Manager) limits(key string, def Limits) Limits {
+	if l, ok := m.config.Overrides[key]; ok {
+		return l
+	}
+	return def
+}
+
+func (m *Manager) checkLocked(counters map[string]*counter, scope, key string, limits Limits, now time.Time) error {
+	c, ok := counters[key]
+	if !ok {
+		return nil
+	}
+	c.roll(now)
+	exceeded := &Exceeded{Scope: scope, Key: key, Unit: m.config.Unit}
+	switch {
+	case limits.Daily > 0 && c.Daily >= limits.Daily:
+		exceeded.Period, exceeded.Limit, exceeded.Used = PeriodDaily, limits.Daily, c.Daily
+		exceeded.Resets = c.Day.AddDate(0, 0, 1)
+	case limits.Monthly > 0 && c.Monthly >= limits.Monthly:
+		exceeded.Period, exceeded.Limit, exceeded.Used = PeriodMonthly, limits.Monthly, c.Monthly
+		exceeded.Resets = c.Month.AddDate(0, 1, 0)
+	default:
+		return nil
+	}
+	return exceeded
+}
+
+// charge adds n to the usage of the user with the given email and their
+// email domain
+func (m *Manager) charge(email string, n int64) {
+	email = strings.ToLower(email)
+	if email == "" || n <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now().UTC()
+	add := func(counters map[string]*counter, key string) {
+		c, ok := counters[key]
+		if !ok {
+			c = &counter{}
+			counters[key] = c
+		}
+		c.roll(now)
+		c.Daily += n
+		c.Monthly += n
+	}
+	add(m.users, email)
+	if domain := domainOf(email); domain != "" {
+		add(m.domains, domain)
+	}
+}
+
+// ChargeChars counts chars characters sent for translation against the user
+// ctx attributes usage to, if quotas are counted in characters
+func (m *Manager) ChargeChars(ctx context.Context, chars int) {
+	if m.config.Unit == UnitChars {
+		m.charge(usage.FromContext(ctx).User, int64(chars))
+	}
+}
+
+// Record implements usage.Recorder, counting the tokens of a model response
+// against the user ctx attributes usage to, if quotas are counted in tokens
+func (m *Manager) Record(ctx context.Context, model string, promptTokens, completionTokens int) {
+	if m.config.Unit == UnitTokens {
+		m.charge(usage.FromContext(ctx).User, int64(promptTokens+completionTokens))
+	}
+}
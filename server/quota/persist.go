@@ -0,0 +1,113 @@
+package quota
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// savedCounts is the persisted form of a Manager's counts
+type savedCounts struct {
+	Users   map[string]*counter `json:"users"`
+	Domains map[string]*counter `json:"domains"`
+}
+
+// load reads the counts saved at the persistence path
+func (m *Manager) load() error {
+	data, err := os.ReadFile(m.config.PersistPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read quota counts: %w", err)
+	}
+
+	var saved savedCounts
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("failed to decode quota counts: %w", err)
+	}
+	for key, c := range saved.Users {
+		m.users[key] = c
+	}
+	for key, c := range saved.Domains {
+		m.domains[key] = c
+	}
+	log.Printf("Loaded quota counts of %d users and %d domains from %s", len(m.users), len(m.domains), m.config.PersistPath)
+	return nil
+}
+
+// Save writes the counts to the persistence file, if one is configured.
+// Counts from before the current month are dropped.
+func (m *Manager) Save() error {
+	if m.config.PersistPath == "" {
+		return nil
+	}
+
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
+	m.mu.Lock()
+	now := m.now().UTC()
+	saved := savedCounts{Users: current(m.users, now), Domains: current(m.domains, now)}
+	data, err := json.Marshal(saved)
+	m.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode quota counts: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.config.PersistPath), 0o750); err != nil {
+		return fmt.Errorf("failed to create quota directory: %w", err)
+	}
+	// Write to a temporary file first so a crash never leaves truncated counts
+	tmp := m.config.PersistPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return fmt.Errorf("failed to write quota counts: %w", err)
+	}
+	if err := os.Rename(tmp, m.config.PersistPath); err != nil {
+		return fmt.Errorf("failed to write quota counts: %w", err)
+	}
+	return nil
+}
+
+// current returns the counters that still count towards this month
+func current(counters map[string]*counter, now time.Time) map[string]*counter {
+	result := make(map[string]*counter, len(counters))
+	for key, c := range counters {
+		c.roll(now)
+		if c.Monthly > 0 || c.Daily > 0 {
+			result[key] = c
+		}
+	}
+	return result
+}
+
+// saveLoop saves the counts every interval until the Manager is closed
+func (m *Manager) saveLoop(interval time.Duration) {
+	defer close(m.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			if err := m.Save(); err != nil {
+				log.Printf("Error saving quota counts: %v", err)
+			}
+		}
+	}
+}
+
+// Close stops the periodic save and saves the counts
+func (m *Manager) Close() error {
+	m.once.Do(func() {
+		close(m.stop)
+	})
+	<-m.done
+	return m.Save()
+}
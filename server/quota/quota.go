@@ -0,0 +1,128 @@
+// Package quota limits how much translation each user and each email domain
+// may use per day and per month.
+package quota
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Unit is what quotas are counted in
+type Unit string
+
+const (
+	// UnitChars counts the characters sent for translation, once per target
+	// language
+	UnitChars Unit = "chars"
+	// UnitTokens counts the prompt and completion tokens OpenAI reports
+	UnitTokens Unit = "tokens"
+)
+
+// ParseUnit parses chars or tokens
+func ParseUnit(s string) (Unit, error) {
+	switch u := Unit(strings.ToLower(strings.TrimSpace(s))); u {
+	case UnitChars, UnitTokens:
+		return u, nil
+	default:
+		return "", fmt.Errorf("invalid quota unit %q, want chars or tokens", s)
+	}
+}
+
+// Limits caps usage per UTC calendar day and month; zero means no limit
+type Limits struct {
+	Daily   int64
+	Monthly int64
+}
+
+// ParseLimits parses limits written as comma-separated key=daily/monthly
+// entries keyed by an email or an email domain, such as
+// "alice@example.com=5000/100000,example.org=0/2000000"
+func ParseLimits(s string) (map[string]Limits, error) {
+	limits := make(map[string]Limits)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, values, ok := strings.Cut(entry, "=")
+		daily, monthly, ok2 := strings.Cut(values, "/")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !ok || !ok2 || key == "" {
+			return nil, fmt.Errorf("invalid quota %q, want key=daily/monthly", entry)
+		}
+		var l Limits
+		var err error
+		if l.Daily, err = strconv.ParseInt(strings.TrimSpace(daily), 10, 64); err != nil || l.Daily < 0 {
+			return nil, fmt.Errorf("invalid daily quota in %q", entry)
+		}
+		if l.Monthly, err = strconv.ParseInt(strings.TrimSpace(monthly), 10, 64); err != nil || l.Monthly < 0 {
+			return nil, fmt.Errorf("invalid monthly quota in %q", entry)
+		}
+		limits[key] = l
+	}
+	return limits, nil
+}
+
+// Config holds the quotas to enforce
+type Config struct {
+	Unit Unit
+	// User applies to each user and Domain to all users of each email domain
+	// together, unless Overrides has an entry for the email or domain
+	User      Limits
+	Domain    Limits
+	Overrides map[string]Limits
+	// PersistPath is a JSON file the counts are loaded from and saved to
+	// every SaveInterval and on Close, so quotas survive restarts; empty
+	// keeps them in memory only
+	PersistPath  string
+	SaveInterval time.Duration
+}
+
+// Enabled reports whether any quota is configured
+func (c Config) Enabled() bool {
+	if c.User != (Limits{}) || c.Domain != (Limits{}) {
+		return true
+	}
+	for _, l := range c.Overrides {
+		if l != (Limits{}) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scopes and periods a quota can be exceeded in
+const (
+	ScopeUser     = "user"
+	ScopeDomain   = "domain"
+	PeriodDaily   = "daily"
+	PeriodMonthly = "monthly"
+)
+
+// Exceeded is the error returned for a quota that is used up
+type Exceeded struct {
+	Scope  string    `json:"scope"`
+	Key    string    `json:"key"` // the email or domain
+	Period string    `json:"period"`
+	Unit   Unit      `json:"unit"`
+	Limit  int64     `json:"limit"`
+	Used   int64     `json:"used"`
+	Resets time.Time `json:"resets"`
+}
+
+// Error implements the error interface
+func (e *Exceeded) Error() string {
+	return fmt.Sprintf("%s translation quota of %d %s for %s is used up until %s",
+		e.Period, e.Limit, e.Unit, e.Key, e.Resets.Format(time.RFC3339))
+}
+
+// domainOf returns the domain of an email address, or "" if it has none
+func domainOf(email string) string {
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return ""
+	}
+	return email[i+1:]
+}
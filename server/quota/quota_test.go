@@ -0,0 +1,128 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"shabe/server/usage"
+)
+
+func attributed(email string) context.Context {
+	return usage.NewContext(context.Background(), usage.Attribution{Room: "lobby", User: email})
+}
+
+func TestParseLimits(t *testing.T) {
+	limits, err := ParseLimits("Alice@Example.com=5000/100000, example.org = 0/2000000")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Limits{
+		"alice@example.com": {Daily: 5000, Monthly: 100000},
+		"example.org":       {Monthly: 2000000},
+	}, limits)
+
+	for _, invalid := range []string{"example.org", "example.org=1", "=1/2", "example.org=a/2", "example.org=1/-2"} {
+		_, err := ParseLimits(invalid)
+		assert.Error(t, err, invalid)
+	}
+
+	unit, err := ParseUnit("Tokens")
+	assert.NoError(t, err)
+	assert.Equal(t, UnitTokens, unit)
+	_, err = ParseUnit("words")
+	assert.Error(t, err)
+
+	assert.True(t, Config{Unit: UnitChars, Overrides: limits}.Enabled())
+	assert.False(t, Config{Unit: UnitChars}.Enabled())
+}
+
+func TestManager(t *testing.T) {
+	now := time.Date(2026, 3, 31, 22, 0, 0, 0, time.UTC)
+	m, err := NewManager(Config{
+		Unit:      UnitChars,
+		User:      Limits{Daily: 100},
+		Domain:    Limits{Monthly: 250},
+		Overrides: map[string]Limits{"boss@example.com": {}},
+	})
+	assert.NoError(t, err)
+	m.now = func() time.Time { return now }
+
+	m.ChargeChars(attributed("alice@example.com"), 99)
+	assert.NoError(t, m.Check("alice@example.com"))
+
+	// Usage up to the limit is allowed; the next message is refused
+	m.ChargeChars(attributed("Alice@example.com"), 1)
+	var exceeded *Exceeded
+	assert.True(t, errors.As(m.Check("alice@example.com"), &exceeded))
+	assert.Equal(t, Exceeded{
+		Scope: ScopeUser, Key: "alice@example.com", Period: PeriodDaily, Unit: UnitChars,
+		Limit: 100, Used: 100, Resets: time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC),
+	}, *exceeded)
+
+	// Other users of the domain share its quota; an override lifts the
+	// user's own limit but not the domain's
+	assert.NoError(t, m.Check("bob@example.com"))
+	m.ChargeChars(attributed("boss@example.com"), 150)
+	assert.NoError(t, m.Check("other@example.org"))
+	err = m.Check("boss@example.com")
+	assert.True(t, errors.As(err, &exceeded))
+	assert.Equal(t, ScopeDomain, exceeded.Scope)
+	assert.Equal(t, PeriodMonthly, exceeded.Period)
+	assert.Contains(t, err.Error(), "monthly translation quota of 250 chars for example.com")
+
+	// Token usage is not counted against character quotas, and users
+	// without an email are not limited
+	m.Record(attributed("bob@example.org"), "gpt-4o-mini", 1000, 1000)
+	assert.NoError(t, m.Check("bob@example.org"))
+	m.ChargeChars(context.Background(), 1000)
+	assert.NoError(t, m.Check(""))
+
+	// Quotas start over with the next day and month
+	now = now.Add(3 * time.Hour)
+	assert.NoError(t, m.Check("alice@example.com"))
+	assert.NoError(t, m.Check("boss@example.com"))
+}
+
+func TestManager_Tokens(t *testing.T) {
+	m, err := NewManager(Config{Unit: UnitTokens, User: Limits{Monthly: 1000}})
+	assert.NoError(t, err)
+
+	m.ChargeChars(attributed("alice@example.com"), 5000)
+	assert.NoError(t, m.Check("alice@example.com"))
+
+	var recorder usage.Recorder = usage.Recorders{m}
+	recorder.Record(attributed("alice@example.com"), "gpt-4o-mini", 900, 100)
+	assert.Error(t, m.Check("alice@example.com"))
+}
+
+func TestManager_Persistence(t *testing.T) {
+	cfg := Config{
+		Unit:        UnitChars,
+		User:        Limits{Monthly: 100},
+		PersistPath: filepath.Join(t.TempDir(), "data", "quotas.json"),
+	}
+	now := time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC)
+
+	m, err := NewManager(cfg)
+	assert.NoError(t, err)
+	m.now = func() time.Time { return now }
+	m.ChargeChars(attributed("alice@example.com"), 100)
+	m.ChargeChars(attributed("bob@example.com"), 10)
+	assert.NoError(t, m.Close())
+
+	// A restarted server still enforces the month's quota
+	restarted, err := NewManager(cfg)
+	assert.NoError(t, err)
+	restarted.now = func() time.Time { return now.Add(24 * time.Hour) }
+	assert.Error(t, restarted.Check("alice@example.com"))
+	assert.NoError(t, restarted.Check("bob@example.com"))
+
+	// Counts from past months are not saved again
+	restarted.now = func() time.Time { return now.AddDate(0, 1, 0) }
+	assert.NoError(t, restarted.Close())
+	reloaded, err := NewManager(cfg)
+	assert.NoError(t, err)
+	assert.Empty(t, reloaded.users)
+}
@@ -0,0 +1,208 @@
+package transcript
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"shabe/server/language"
+)
+
+// Format is a transcript export format
+type Format string
+
+// Supported export formats
+const (
+	FormatSRT      Format = "srt"
+	FormatVTT      Format = "vtt"
+	FormatMarkdown Format = "md"
+	FormatJSON     Format = "json"
+)
+
+// ParseFormat parses a format name, defaulting to JSON when name is empty
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case "":
+		return FormatJSON, nil
+	case FormatSRT, FormatVTT, FormatMarkdown, FormatJSON:
+		return Format(name), nil
+	default:
+		return "", fmt.Errorf("unsupported transcript format: %s", name)
+	}
+}
+
+// ContentType returns the MIME type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatSRT:
+		return "application/x-subrip; charset=utf-8"
+	case FormatVTT:
+		return "text/vtt; charset=utf-8"
+	case FormatMarkdown:
+		return "text/markdown; charset=utf-8"
+	default:
+		return "application/json"
+	}
+}
+
+// Caption timing bounds used for subtitle formats
+const (
+	minCueDuration = 2 * time.Second
+	maxCueDuration = 7 * time.Second
+	perRuneReading = 60 * time.Millisecond
+)
+
+// line is an entry rendered in the requested language
+type line struct {
+	Timestamp time.Time `json:"timestamp"`
+	Speaker   string    `json:"speaker"`
+	Language  string    `json:"language"`
+	Text      string    `json:"text"`
+	// untranslated marks a line served in Language because no translation
+	// into the requested language exists; text formats label such lines
+	untranslated bool
+}
+
+// textIn returns the entry's text in lang, or else in its base language such
+// as ja for ja-JP, falling back to the original text when lang is empty or no
+// translation was produced for it
+func (e Entry) textIn(lang string) (string, string) {
+	for _, tag := range []string{lang, language.Base(lang)} {
+		if tag == "" || tag == e.SourceLanguage {
+			return e.Text, e.SourceLanguage
+		}
+		if translated, ok := e.Translations[tag]; ok {
+			return translated, tag
+		}
+	}
+	return e.Text, e.SourceLanguage
+}
+
+// Render writes entries in the given format, translated into lang where
+// translations are available. An empty lang renders the original text.
+// Lines left in another language are labelled with the language they are in.
+func Render(w io.Writer, roomID string, entries []Entry, format Format, lang string) error {
+	lines := make([]line, len(entries))
+	for i, e := range entries {
+		text, textLang := e.textIn(lang)
+		lines[i] = line{
+			Timestamp:    e.Timestamp,
+			Speaker:      e.SenderName,
+			Language:     textLang,
+			Text:         text,
+			untranslated: lang != "" && language.Base(textLang) != language.Base(lang),
+		}
+	}
+
+	switch format {
+	case FormatSRT:
+		return renderCaptions(w, lines, false)
+	case FormatVTT:
+		return renderCaptions(w, lines, true)
+	case FormatMarkdown:
+		return renderMarkdown(w, roomID, lines)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(lines)
+	default:
+		return fmt.Errorf("unsupported transcript format: %s", format)
+	}
+}
+
+// renderCaptions writes SRT or WebVTT cues timed relative to the first message
+func renderCaptions(w io.Writer, lines []line, vtt bool) error {
+	var b strings.Builder
+	if vtt {
+		b.WriteString("WEBVTT\n\n")
+	}
+
+	for i, l := range lines {
+		start := l.Timestamp.Sub(lines[0].Timestamp)
+		end := start + cueDuration(l.Text)
+		if i+1 < len(lines) {
+			if next := lines[i+1].Timestamp.Sub(lines[0].Timestamp); next < end && next > start {
+				end = next
+			}
+		}
+
+		if !vtt {
+			fmt.Fprintf(&b, "%d\n", i+1)
+		}
+		fmt.Fprintf(&b, "%s --> %s\n", formatCueTime(start, vtt), formatCueTime(end, vtt))
+		speaker, text := cueText(l.Speaker), cueText(l.Text)
+		switch {
+		case vtt && l.untranslated:
+			fmt.Fprintf(&b, "<v %s><lang %s>%s</lang>\n\n", vttEscaper.Replace(speaker), vttEscaper.Replace(cueText(l.Language)), vttEscaper.Replace(text))
+		case vtt:
+			fmt.Fprintf(&b, "<v %s>%s\n\n", vttEscaper.Replace(speaker), vttEscaper.Replace(text))
+		case l.untranslated:
+			fmt.Fprintf(&b, "%s: [%s] %s\n\n", speaker, cueText(l.Language), text)
+		default:
+			fmt.Fprintf(&b, "%s: %s\n\n", speaker, text)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// vttEscaper escapes the characters WebVTT cue text reserves for markup
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// cueText puts s on a single line without the --> that separates cue times,
+// so it cannot end its cue or start a new one
+func cueText(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	for strings.Contains(s, "-->") {
+		s = strings.ReplaceAll(s, "-->", "->")
+	}
+	return s
+}
+
+// cueDuration estimates how long a caption should stay on screen
+func cueDuration(text string) time.Duration {
+	d := time.Duration(utf8.RuneCountInString(text)) * perRuneReading
+	if d < minCueDuration {
+		return minCueDuration
+	}
+	if d > maxCueDuration {
+		return maxCueDuration
+	}
+	return d
+}
+
+// formatCueTime formats an offset as HH:MM:SS,mmm (SRT) or HH:MM:SS.mmm (WebVTT)
+func formatCueTime(d time.Duration, vtt bool) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Milliseconds()
+	sep := ","
+	if vtt {
+		sep = "."
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// renderMarkdown writes a wiki-friendly transcript
+func renderMarkdown(w io.Writer, roomID string, lines []line) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Transcript: %s\n\n", roomID)
+	if len(lines) > 0 {
+		fmt.Fprintf(&b, "_%s_\n\n", lines[0].Timestamp.UTC().Format("2006-01-02 15:04 MST"))
+	}
+	for _, l := range lines {
+		if l.untranslated {
+			fmt.Fprintf(&b, "**%s** (%s) [%s]: %s\n\n", l.Speaker, l.Timestamp.UTC().Format("15:04:05"), l.Language, l.Text)
+		} else {
+			fmt.Fprintf(&b, "**%s** (%s): %s\n\n", l.Speaker, l.Timestamp.UTC().Format("15:04:05"), l.Text)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
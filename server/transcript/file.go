@@ -0,0 +1,100 @@
+package transcript
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// safeRoomID matches room IDs that can be used as file names as they are
+var safeRoomID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// FileStore implements the Store interface with one append-only JSON Lines
+// file per room in a directory
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileStore creates a FileStore rooted at dir, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create transcript directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// path returns the file that holds a room's transcript. Room IDs that are
+// not safe file names are hex encoded.
+func (s *FileStore) path(roomID string) string {
+	name := roomID
+	if !safeRoomID.MatchString(roomID) {
+		name = "x-" + hex.EncodeToString([]byte(roomID))
+	}
+	return filepath.Join(s.dir, name+".jsonl")
+}
+
+// Append records an entry
+func (s *FileStore) Append(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode transcript entry: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path(entry.RoomID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open transcript: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write transcript: %w", err)
+	}
+	return nil
+}
+
+// List returns every entry recorded for a room, oldest first
+func (s *FileStore) List(roomID string) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.path(roomID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transcript: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to decode transcript entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read transcript: %w", err)
+	}
+
+	sortByTime(entries)
+	return entries, nil
+}
+
+// Close is a no-op for FileStore since files are only open while in use
+func (s *FileStore) Close() error {
+	return nil
+}
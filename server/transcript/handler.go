@@ -0,0 +1,93 @@
+package transcript
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"shabe/server/auth"
+	"shabe/server/language"
+
+	"github.com/gorilla/mux"
+)
+
+// Handler serves transcript exports over HTTP. A transcript can only be
+// exported by the admins and by the users who spoke in the room.
+type Handler struct {
+	store  Store
+	admins []string
+}
+
+// NewHandler creates a new transcript Handler
+func NewHandler(store Store, admins []string) *Handler {
+	return &Handler{store: store, admins: admins}
+}
+
+// HandleExport handles GET /rooms/{id}/transcript?format=srt|vtt|md|json&lang=.
+// It expects the authenticated user in the request context, as set by
+// auth.Manager.AuthMiddleware.
+func (h *Handler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	roomID := mux.Vars(r)["id"]
+	if roomID == "" {
+		http.Error(w, "Missing room ID", http.StatusBadRequest)
+		return
+	}
+
+	format, err := ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Translations are stored under canonical tags, such as ja-JP for ja-jp
+	lang := r.URL.Query().Get("lang")
+	if lang != "" {
+		if lang, err = language.Parse(lang); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := h.store.List(roomID)
+	if err != nil {
+		log.Printf("Error loading transcript for room %s: %v", roomID, err)
+		http.Error(w, "Failed to load transcript", http.StatusInternalServerError)
+		return
+	}
+	// Rooms the user may not read look the same as rooms without a transcript
+	if len(entries) == 0 || !h.canRead(user, entries) {
+		http.Error(w, "Transcript not found", http.StatusNotFound)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := Render(&buf, roomID, entries, format, lang); err != nil {
+		log.Printf("Error rendering transcript for room %s: %v", roomID, err)
+		http.Error(w, "Failed to render transcript", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", roomID+"."+string(format)))
+	w.Write(buf.Bytes())
+}
+
+// canRead reports whether user is an admin or spoke in the transcript
+func (h *Handler) canRead(user *auth.UserInfo, entries []Entry) bool {
+	if auth.IsAdmin(h.admins, user.Email) {
+		return true
+	}
+	for _, e := range entries {
+		if user.Email != "" && strings.EqualFold(e.SenderEmail, user.Email) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package transcript
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Entry is a single recorded chat message together with every translation
+// that was produced for it
+type Entry struct {
+	RoomID         string            `json:"roomId"`
+	SenderName     string            `json:"senderName"`
+	SenderEmail    string            `json:"senderEmail"`
+	SourceLanguage string            `json:"sourceLanguage"`
+	Text           string            `json:"text"`
+	Translations   map[string]string `json:"translations,omitempty"`
+	Timestamp      time.Time         `json:"timestamp"`
+}
+
+// Store defines the interface for transcript storage backends
+type Store interface {
+	// Append records an entry
+	Append(entry Entry) error
+	// List returns every entry recorded for a room, oldest first
+	List(roomID string) ([]Entry, error)
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// MemoryStore implements the Store interface in memory, for tests and
+// deployments that do not need transcripts to survive a restart
+type MemoryStore struct {
+	entries map[string][]Entry
+	mu      sync.RWMutex
+}
+
+// NewMemoryStore creates a new MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string][]Entry),
+	}
+}
+
+// Append records an entry
+func (s *MemoryStore) Append(entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[entry.RoomID] = append(s.entries[entry.RoomID], entry)
+	return nil
+}
+
+// List returns every entry recorded for a room, oldest first
+func (s *MemoryStore) List(roomID string) ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := append([]Entry(nil), s.entries[roomID]...)
+	sortByTime(entries)
+	return entries, nil
+}
+
+// Close is a no-op for MemoryStore
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// sortByTime orders entries by timestamp, keeping insertion order for ties
+func sortByTime(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+}
@@ -0,0 +1,222 @@
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"shabe/server/auth"
+)
+
+func testStore(t *testing.T, store Store) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	entries, err := store.List("abc-defg-hij")
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	first := Entry{
+		RoomID:         "abc-defg-hij",
+		SenderName:     "Test User",
+		SenderEmail:    "test@example.com",
+		SourceLanguage: "en",
+		Text:           "hello",
+		Translations:   map[string]string{"ja": "こんにちは"},
+		Timestamp:      now,
+	}
+	second := first
+	second.Text = "how are you"
+	second.Translations = map[string]string{"ja": "お元気ですか？"}
+	second.Timestamp = now.Add(time.Second)
+
+	// Entries come back in timestamp order regardless of append order
+	assert.NoError(t, store.Append(second))
+	assert.NoError(t, store.Append(first))
+	assert.NoError(t, store.Append(Entry{RoomID: "../other", Text: "elsewhere", Timestamp: now}))
+
+	entries, err = store.List("abc-defg-hij")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, first.Text, entries[0].Text)
+	assert.True(t, first.Timestamp.Equal(entries[0].Timestamp))
+	assert.Equal(t, first.Translations, entries[0].Translations)
+	assert.Equal(t, second.Text, entries[1].Text)
+
+	other, err := store.List("../other")
+	assert.NoError(t, err)
+	assert.Len(t, other, 1)
+
+	assert.NoError(t, store.Close())
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	assert.NoError(t, err)
+	testStore(t, store)
+
+	// Transcripts survive reopening the store
+	reopened, err := NewFileStore(dir)
+	assert.NoError(t, err)
+	entries, err := reopened.List("abc-defg-hij")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func exportEntries() []Entry {
+	start := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	return []Entry{
+		{
+			RoomID:         "abc-defg-hij",
+			SenderName:     "Alice",
+			SenderEmail:    "alice@example.com",
+			SourceLanguage: "en",
+			Text:           "hello",
+			Translations:   map[string]string{"ja": "こんにちは"},
+			Timestamp:      start,
+		},
+		{
+			RoomID:         "abc-defg-hij",
+			SenderName:     "Taro",
+			SourceLanguage: "ja",
+			Text:           "お元気ですか？",
+			Translations:   map[string]string{"en": "how are you"},
+			Timestamp:      start.Add(1500 * time.Millisecond),
+		},
+	}
+}
+
+func TestRender(t *testing.T) {
+	entries := exportEntries()
+
+	t.Run("srt", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, Render(&buf, "abc-defg-hij", entries, FormatSRT, "ja"))
+		assert.Equal(t, "1\n00:00:00,000 --> 00:00:01,500\nAlice: こんにちは\n\n"+
+			"2\n00:00:01,500 --> 00:00:03,500\nTaro: お元気ですか？\n\n", buf.String())
+	})
+
+	t.Run("vtt", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, Render(&buf, "abc-defg-hij", entries, FormatVTT, "en"))
+		assert.Equal(t, "WEBVTT\n\n00:00:00.000 --> 00:00:01.500\n<v Alice>hello\n\n"+
+			"00:00:01.500 --> 00:00:03.500\n<v Taro>how are you\n\n", buf.String())
+	})
+
+	t.Run("captions escape hostile names and text", func(t *testing.T) {
+		hostile := []Entry{{
+			SenderName: "Eve</v><b>&",
+			Text:       "hi\n\n2\n00:00:00,000 --> 00:00:09,000\nfake <i>cue</i> --->",
+			Timestamp:  time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC),
+		}}
+
+		var buf bytes.Buffer
+		assert.NoError(t, Render(&buf, "abc-defg-hij", hostile, FormatVTT, ""))
+		assert.Contains(t, buf.String(), "\n<v Eve&lt;/v&gt;&lt;b&gt;&amp;>"+
+			"hi 2 00:00:00,000 -&gt; 00:00:09,000 fake &lt;i&gt;cue&lt;/i&gt; -&gt;\n\n")
+		assert.Equal(t, 1, strings.Count(buf.String(), "-->"))
+
+		buf.Reset()
+		assert.NoError(t, Render(&buf, "abc-defg-hij", hostile, FormatSRT, ""))
+		assert.Equal(t, 1, strings.Count(buf.String(), "-->"))
+		assert.Equal(t, 1, strings.Count(buf.String(), "\n\n"))
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, Render(&buf, "abc-defg-hij", entries, FormatMarkdown, ""))
+		assert.Contains(t, buf.String(), "# Transcript: abc-defg-hij")
+		assert.Contains(t, buf.String(), "**Alice** (09:30:00): hello")
+		assert.Contains(t, buf.String(), "**Taro** (09:30:01): お元気ですか？")
+	})
+
+	t.Run("json falls back to original text", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, Render(&buf, "abc-defg-hij", entries, FormatJSON, "fr"))
+		var lines []line
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &lines))
+		assert.Len(t, lines, 2)
+		assert.Equal(t, "hello", lines[0].Text)
+		assert.Equal(t, "en", lines[0].Language)
+		assert.Equal(t, "Taro", lines[1].Speaker)
+	})
+
+	t.Run("untranslated lines are labelled with their language", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, Render(&buf, "abc-defg-hij", entries, FormatSRT, "fr"))
+		assert.Contains(t, buf.String(), "\nAlice: [en] hello\n")
+		assert.Contains(t, buf.String(), "\nTaro: [ja] お元気ですか？\n")
+
+		buf.Reset()
+		assert.NoError(t, Render(&buf, "abc-defg-hij", entries, FormatVTT, "ja-JP"))
+		assert.Contains(t, buf.String(), "\n<v Alice>こんにちは\n")
+		assert.Contains(t, buf.String(), "\n<v Taro>お元気ですか？\n")
+
+		buf.Reset()
+		assert.NoError(t, Render(&buf, "abc-defg-hij", entries, FormatVTT, "fr"))
+		assert.Contains(t, buf.String(), "\n<v Alice><lang en>hello</lang>\n")
+
+		buf.Reset()
+		assert.NoError(t, Render(&buf, "abc-defg-hij", entries, FormatMarkdown, "en"))
+		assert.Contains(t, buf.String(), "**Alice** (09:30:00): hello")
+		assert.Contains(t, buf.String(), "**Taro** (09:30:01): how are you")
+
+		buf.Reset()
+		assert.NoError(t, Render(&buf, "abc-defg-hij", entries, FormatMarkdown, "ja"))
+		assert.Contains(t, buf.String(), "**Taro** (09:30:01): お元気ですか？")
+		assert.Contains(t, buf.String(), "**Alice** (09:30:00): こんにちは")
+
+		buf.Reset()
+		assert.NoError(t, Render(&buf, "abc-defg-hij", entries, FormatMarkdown, "fr"))
+		assert.Contains(t, buf.String(), "**Alice** (09:30:00) [en]: hello")
+	})
+}
+
+func TestHandler_HandleExport(t *testing.T) {
+	store := NewMemoryStore()
+	for _, e := range exportEntries() {
+		store.Append(e)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/rooms/{id}/transcript", NewHandler(store, []string{"admin@example.com"}).HandleExport).Methods("GET")
+	get := func(target, email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if email != "" {
+			req = req.WithContext(auth.NewContext(req.Context(), &auth.UserInfo{Email: email}))
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/rooms/abc-defg-hij/transcript?format=vtt&lang=ja", "Alice@example.com")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/vtt; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "<v Alice>こんにちは")
+
+	assert.Equal(t, http.StatusBadRequest, get("/rooms/abc-defg-hij/transcript?format=docx", "alice@example.com").Code)
+
+	// lang is normalized, and a regional tag falls back to its base language
+	for _, lang := range []string{"JA", "ja-jp", "ja_JP"} {
+		w := get("/rooms/abc-defg-hij/transcript?format=vtt&lang="+lang, "alice@example.com")
+		assert.Contains(t, w.Body.String(), "<v Alice>こんにちは", lang)
+	}
+	assert.Equal(t, http.StatusBadRequest, get("/rooms/abc-defg-hij/transcript?lang=not-a-language", "alice@example.com").Code)
+	assert.Equal(t, http.StatusNotFound, get("/rooms/unknown/transcript", "alice@example.com").Code)
+
+	// Only admins and people who spoke in the room may export its transcript
+	assert.Equal(t, http.StatusOK, get("/rooms/abc-defg-hij/transcript", "admin@example.com").Code)
+	assert.Equal(t, http.StatusNotFound, get("/rooms/abc-defg-hij/transcript", "mallory@example.com").Code)
+	assert.Equal(t, http.StatusUnauthorized, get("/rooms/abc-defg-hij/transcript", "").Code)
+}
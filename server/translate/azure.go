@@ -0,0 +1,79 @@
+package translate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const azureTranslatorURL = "https://api.cognitive.microsofttranslator.com"
+
+// AzureConfig holds the AzureTranslator configuration
+type AzureConfig struct {
+	Key string
+	// Region is required for regional and multi-service resources
+	Region     string
+	Endpoint   string // overrides the global endpoint
+	HTTPClient *http.Client
+}
+
+// AzureTranslator implements the Translator interface using Azure AI
+// Translator (v3)
+type AzureTranslator struct {
+	config AzureConfig
+}
+
+// NewAzureTranslator creates a new AzureTranslator
+func NewAzureTranslator(cfg AzureConfig) *AzureTranslator {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = azureTranslatorURL
+	}
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+	return &AzureTranslator{config: cfg}
+}
+
+type azureRequest struct {
+	Text string `json:"Text"`
+}
+
+type azureResponse struct {
+	Translations []struct {
+		Text string `json:"text"`
+		To   string `json:"to"`
+	} `json:"translations"`
+}
+
+// Translate translates text from one language to another using Azure
+// Translator
+func (t *AzureTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	if fromLang == toLang {
+		return text, nil
+	}
+
+	query := url.Values{}
+	query.Set("api-version", "3.0")
+	query.Set("to", toLang)
+	if fromLang != "" {
+		query.Set("from", fromLang)
+	}
+
+	header := http.Header{}
+	header.Set("Ocp-Apim-Subscription-Key", t.config.Key)
+	if t.config.Region != "" {
+		header.Set("Ocp-Apim-Subscription-Region", t.config.Region)
+	}
+
+	var resp []azureResponse
+	err := postJSON(ctx, t.config.HTTPClient, "Azure Translator", t.config.Endpoint+"/translate?"+query.Encode(), header,
+		[]azureRequest{{Text: text}}, &resp)
+	if err != nil {
+		return "", err
+	}
+
+	if len(resp) == 0 || len(resp[0].Translations) == 0 {
+		return "", fmt.Errorf("no translation received from Azure Translator")
+	}
+	return resp[0].Translations[0].Text, nil
+}
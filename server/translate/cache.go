@@ -0,0 +1,332 @@
+package translate
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"shabe/server/glossary"
+)
+
+// CacheOptions configures a CachingTranslator
+type CacheOptions struct {
+	// Size is the maximum number of cached translations
+	Size int
+	// TTL is how long a translation stays cached; zero means forever
+	TTL time.Duration
+	// PersistPath is a file the cache is loaded from on start and saved to
+	// on Close; empty disables persistence
+	PersistPath string
+	// Fingerprint identifies the configuration of the wrapped translator,
+	// such as its providers, model and prompt. Persisted entries saved with
+	// a different fingerprint are dropped on load.
+	Fingerprint string
+}
+
+// CacheStats reports cache effectiveness
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Size   int
+}
+
+// cacheKey identifies a translation by normalized text, language pair and
+// the glossary it was made with
+type cacheKey struct {
+	Text     string `json:"text"`
+	FromLang string `json:"from"`
+	ToLang   string `json:"to"`
+	Glossary string `json:"glossary,omitempty"`
+	// Formality is empty for FormalityAuto so older cache files stay valid
+	Formality Formality `json:"formality,omitempty"`
+}
+
+// cacheEntry is a cached translation, also used as the persistence format
+type cacheEntry struct {
+	Key         cacheKey  `json:"key"`
+	Translation string    `json:"translation"`
+	Expires     time.Time `json:"expires,omitempty"`
+	// Fingerprint is the CacheOptions.Fingerprint the entry was saved with
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// CachingTranslator wraps a Translator with an in-memory LRU cache
+type CachingTranslator struct {
+	next   Translator
+	opts   CacheOptions
+	mu     sync.Mutex
+	lru    *list.List // of *cacheEntry, most recently used first
+	items  map[cacheKey]*list.Element
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// NewCachingTranslator creates a CachingTranslator in front of next, loading
+// any previously persisted entries
+func NewCachingTranslator(next Translator, opts CacheOptions) (*CachingTranslator, error) {
+	if opts.Size <= 0 {
+		return nil, fmt.Errorf("cache size must be positive")
+	}
+
+	c := &CachingTranslator{
+		next:  next,
+		opts:  opts,
+		lru:   list.New(),
+		items: make(map[cacheKey]*list.Element),
+	}
+	if opts.PersistPath != "" {
+		if err := c.load(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// newCacheKey returns the cache key of a translation made with the glossary
+// and formality carried by ctx
+func newCacheKey(ctx context.Context, text, fromLang, toLang string) cacheKey {
+	key := cacheKey{
+		Text:     normalizeText(text),
+		FromLang: fromLang,
+		ToLang:   toLang,
+		Glossary: glossary.FromContext(ctx).For(fromLang, toLang).Fingerprint(),
+	}
+	if f := FormalityFromContext(ctx); f != FormalityAuto {
+		key.Formality = f
+	}
+	return key
+}
+
+// normalizeText trims text and collapses runs of whitespace
+func normalizeText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// Translate returns a cached translation if there is one, otherwise it
+// translates with the wrapped translator and caches the result
+func (c *CachingTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	if fromLang == toLang {
+		return text, nil
+	}
+
+	key := newCacheKey(ctx, text, fromLang, toLang)
+	if translation, ok := c.get(key); ok {
+		c.hits.Add(1)
+		return translation, nil
+	}
+	c.misses.Add(1)
+
+	translation, err := c.next.Translate(ctx, text, fromLang, toLang)
+	if err != nil {
+		return "", err
+	}
+	c.put(key, translation)
+	return translation, nil
+}
+
+// TranslateStream returns a cached translation if there is one, otherwise it
+// streams from the wrapped translator and caches the result. Like
+// TranslateConversation, it bypasses the cache when given context.
+func (c *CachingTranslator) TranslateStream(ctx context.Context, turns []Turn, text, fromLang, toLang string, onDelta func(partial string)) (string, error) {
+	if fromLang == toLang {
+		return text, nil
+	}
+	if len(turns) > 0 {
+		return translateStream(ctx, c.next, turns, text, fromLang, toLang, onDelta)
+	}
+
+	key := newCacheKey(ctx, text, fromLang, toLang)
+	if translation, ok := c.get(key); ok {
+		c.hits.Add(1)
+		return translation, nil
+	}
+	c.misses.Add(1)
+
+	translation, err := translateStream(ctx, c.next, nil, text, fromLang, toLang, onDelta)
+	if err != nil {
+		return "", err
+	}
+	c.put(key, translation)
+	return translation, nil
+}
+
+// TranslateMulti returns cached translations where there are any and
+// translates the rest with the wrapped translator in one go, caching the
+// results
+func (c *CachingTranslator) TranslateMulti(ctx context.Context, text, fromLang string, toLangs []string) (map[string]string, error) {
+	translations := make(map[string]string, len(toLangs))
+	var missing []string
+	for _, lang := range toLangs {
+		if lang == fromLang {
+			translations[lang] = text
+			continue
+		}
+		if translation, ok := c.get(newCacheKey(ctx, text, fromLang, lang)); ok {
+			c.hits.Add(1)
+			translations[lang] = translation
+			continue
+		}
+		c.misses.Add(1)
+		missing = append(missing, lang)
+	}
+	if len(missing) == 0 {
+		return translations, nil
+	}
+
+	rest, err := translateMulti(ctx, c.next, text, fromLang, missing)
+	if err != nil {
+		return nil, err
+	}
+	for _, lang := range missing {
+		translations[lang] = rest[lang]
+		c.put(newCacheKey(ctx, text, fromLang, lang), rest[lang])
+	}
+	return translations, nil
+}
+
+// TranslateConversation bypasses the cache, since a context-aware translation
+// depends on more than the text itself. Without context it behaves like
+// Translate; wrapped translators without context support are called through
+// the cache.
+func (c *CachingTranslator) TranslateConversation(ctx context.Context, turns []Turn, text, fromLang, toLang string) (string, error) {
+	ct, ok := c.next.(ConversationTranslator)
+	if !ok || len(turns) == 0 {
+		return c.Translate(ctx, text, fromLang, toLang)
+	}
+	return ct.TranslateConversation(ctx, turns, text, fromLang, toLang)
+}
+
+func (c *CachingTranslator) get(key cacheKey) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !entry.Expires.IsZero() && time.Now().After(entry.Expires) {
+		c.lru.Remove(elem)
+		delete(c.items, key)
+		return "", false
+	}
+	c.lru.MoveToFront(elem)
+	return entry.Translation, true
+}
+
+func (c *CachingTranslator) put(key cacheKey, translation string) {
+	var expires time.Time
+	if c.opts.TTL > 0 {
+		expires = time.Now().Add(c.opts.TTL)
+	}
+	c.add(&cacheEntry{Key: key, Translation: translation, Expires: expires})
+}
+
+// add inserts an entry as the most recently used, evicting the least
+// recently used entry if the cache is full
+func (c *CachingTranslator) add(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[entry.Key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.items[entry.Key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.opts.Size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).Key)
+	}
+}
+
+// Stats returns the cache's hit and miss counts and current size
+func (c *CachingTranslator) Stats() CacheStats {
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Size: size}
+}
+
+// load reads persisted entries, skipping any that have expired or were made
+// by a differently configured translator
+func (c *CachingTranslator) load() error {
+	data, err := os.ReadFile(c.opts.PersistPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read translation cache: %w", err)
+	}
+
+	var entries []cacheEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to decode translation cache: %w", err)
+	}
+
+	// Entries are stored most recently used first, so add them in reverse
+	now := time.Now()
+	stale := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Fingerprint != c.opts.Fingerprint {
+			stale++
+			continue
+		}
+		if !entries[i].Expires.IsZero() && now.After(entries[i].Expires) {
+			continue
+		}
+		c.add(&entries[i])
+	}
+	if stale > 0 {
+		log.Printf("Dropped %d cached translations made with a different translator configuration", stale)
+	}
+	log.Printf("Loaded %d cached translations from %s", c.lru.Len(), c.opts.PersistPath)
+	return nil
+}
+
+// Save writes the cache to its persistence file, if one is configured
+func (c *CachingTranslator) Save() error {
+	if c.opts.PersistPath == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	entries := make([]cacheEntry, 0, c.lru.Len())
+	for elem := c.lru.Front(); elem != nil; elem = elem.Next() {
+		entry := *elem.Value.(*cacheEntry)
+		entry.Fingerprint = c.opts.Fingerprint
+		entries = append(entries, entry)
+	}
+	c.mu.Unlock()
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode translation cache: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated cache
+	tmp := c.opts.PersistPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return fmt.Errorf("failed to write translation cache: %w", err)
+	}
+	if err := os.Rename(tmp, c.opts.PersistPath); err != nil {
+		return fmt.Errorf("failed to write translation cache: %w", err)
+	}
+	return nil
+}
+
+// Close logs the cache statistics and persists the cache
+func (c *CachingTranslator) Close() error {
+	stats := c.Stats()
+	log.Printf("Translation cache: hits=%d misses=%d size=%d", stats.Hits, stats.Misses, stats.Size)
+	return c.Save()
+}
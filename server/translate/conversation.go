@@ -0,0 +1,94 @@
+package translate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Turn is an earlier message in a conversation, given to a translator as context
+type Turn struct {
+	Speaker  string
+	Language string
+	Text     string
+	// Translation is the text previously delivered in the target language;
+	// empty if the turn was not translated into it
+	Translation string
+}
+
+// ConversationTranslator is implemented by translators that can use recent
+// conversation turns to keep pronouns, terminology and fragments consistent
+type ConversationTranslator interface {
+	Translator
+	TranslateConversation(ctx context.Context, turns []Turn, text, fromLang, toLang string) (string, error)
+}
+
+// EstimateTokens roughly estimates how many tokens text uses: about four
+// characters per token for alphabetic scripts and one per character for CJK
+func EstimateTokens(text string) int {
+	quarterTokens := 0
+	for _, r := range text {
+		if r >= 0x2E80 {
+			quarterTokens += 4
+		} else {
+			quarterTokens++
+		}
+	}
+	return (quarterTokens + 3) / 4
+}
+
+// trimTurns returns the most recent turns that fit within the token budget,
+// oldest first
+func trimTurns(turns []Turn, budget int) []Turn {
+	used := 0
+	start := len(turns)
+	for start > 0 {
+		t := turns[start-1]
+		cost := EstimateTokens(t.Speaker) + EstimateTokens(t.Text) + EstimateTokens(t.Translation)
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		start--
+	}
+	return turns[start:]
+}
+
+// conversationMessages builds the chat messages for a context-aware
+// translation. Turns that were translated into the target language become
+// user/assistant pairs so the model continues in the same style; other turns
+// are given as system notes, keeping the conversation in order.
+func conversationMessages(prompt *Prompt, turns []Turn, data PromptData) ([]openai.ChatCompletionMessage, error) {
+	system, user, err := prompt.render(data)
+	if err != nil {
+		return nil, err
+	}
+	messages := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: system}}
+
+	for _, t := range turns {
+		if t.Translation != "" && t.Language != data.To {
+			// The turn was written in its own language, not the new message's
+			turn := data
+			turn.Text, turn.From, turn.FromName = t.Text, t.Language, ""
+			_, earlier, err := prompt.render(turn)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages,
+				openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: earlier},
+				openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: t.Translation},
+			)
+			continue
+		}
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: fmt.Sprintf("%s said (%s): %s", t.Speaker, t.Language, t.Text),
+		})
+	}
+
+	return append(messages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: user,
+	}), nil
+}
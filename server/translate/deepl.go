@@ -0,0 +1,132 @@
+package translate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	deepLProURL  = "https://api.deepl.com"
+	deepLFreeURL = "https://api-free.deepl.com"
+)
+
+// DeepLConfig holds the DeepLTranslator configuration
+type DeepLConfig struct {
+	APIKey string
+	// BaseURL overrides the API endpoint. By default keys ending in ":fx"
+	// use the free API and all others the pro API.
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// DeepLTranslator implements the Translator interface using the DeepL API
+type DeepLTranslator struct {
+	config DeepLConfig
+}
+
+// NewDeepLTranslator creates a new DeepLTranslator
+func NewDeepLTranslator(cfg DeepLConfig) *DeepLTranslator {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = deepLProURL
+		if strings.HasSuffix(cfg.APIKey, ":fx") {
+			cfg.BaseURL = deepLFreeURL
+		}
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	return &DeepLTranslator{config: cfg}
+}
+
+type deepLRequest struct {
+	Text       []string `json:"text"`
+	SourceLang string   `json:"source_lang,omitempty"`
+	TargetLang string   `json:"target_lang"`
+	Formality  string   `json:"formality,omitempty"`
+}
+
+type deepLResponse struct {
+	Translations []struct {
+		DetectedSourceLanguage string `json:"detected_source_language"`
+		Text                   string `json:"text"`
+	} `json:"translations"`
+}
+
+// Translate translates text from one language to another using DeepL
+func (t *DeepLTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	if fromLang == toLang {
+		return text, nil
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "DeepL-Auth-Key "+t.config.APIKey)
+
+	var resp deepLResponse
+	err := postJSON(ctx, t.config.HTTPClient, "DeepL", t.config.BaseURL+"/v2/translate", header, deepLRequest{
+		Text:       []string{text},
+		SourceLang: deepLSourceLang(fromLang),
+		TargetLang: deepLTargetLang(toLang),
+		Formality:  deepLFormality(FormalityFromContext(ctx)),
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+
+	if len(resp.Translations) == 0 {
+		return "", fmt.Errorf("no translation received from DeepL")
+	}
+	return resp.Translations[0].Text, nil
+}
+
+// deepLSourceLang converts a language code to a DeepL source language, which
+// never carries a region
+func deepLSourceLang(lang string) string {
+	base, _, _ := strings.Cut(lang, "-")
+	return strings.ToUpper(base)
+}
+
+// deepLFormality converts a formality to DeepL's. The prefer_ variants are
+// ignored for target languages without formality support instead of failing.
+func deepLFormality(f Formality) string {
+	switch f {
+	case FormalityFormal:
+		return "prefer_more"
+	case FormalityInformal:
+		return "prefer_less"
+	}
+	return ""
+}
+
+// deepLVariants are the regional and script variants DeepL translates into,
+// keyed by lowercase base language and subtag
+var deepLVariants = map[string]string{
+	"en-gb":   "EN-GB",
+	"en-us":   "EN-US",
+	"pt-br":   "PT-BR",
+	"pt-pt":   "PT-PT",
+	"zh-hans": "ZH-HANS",
+	"zh-hant": "ZH-HANT",
+	"zh-tw":   "ZH-HANT",
+	"zh-hk":   "ZH-HANT",
+	"zh-mo":   "ZH-HANT",
+}
+
+// deepLTargetLang converts a language code to a DeepL target language. DeepL
+// rejects variants it does not support, such as JA-JP, so only those in
+// deepLVariants are kept; English and Portuguese always need one.
+func deepLTargetLang(lang string) string {
+	subtags := strings.Split(strings.ToLower(lang), "-")
+	base := subtags[0]
+	for _, subtag := range subtags[1:] {
+		if variant, ok := deepLVariants[base+"-"+subtag]; ok {
+			return variant
+		}
+	}
+	switch base {
+	case "en":
+		return "EN-US"
+	case "pt":
+		return "PT-BR"
+	}
+	return strings.ToUpper(base)
+}
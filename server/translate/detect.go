@@ -0,0 +1,238 @@
+package translate
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/sashabaranov/go-openai"
+	"shabe/server/language"
+)
+
+// LanguageDetector is implemented by services that can identify the language
+// of a text. Confidence ranges from 0 to 1; callers should ignore detections
+// below their own threshold.
+type LanguageDetector interface {
+	DetectLanguage(ctx context.Context, text string) (lang string, confidence float64, err error)
+}
+
+// minDetectLetters is the fewest letters the NgramDetector will judge; shorter
+// texts are reported with zero confidence
+const minDetectLetters = 12
+
+// scriptLanguages maps writing systems to the language most often written in
+// them. others lists further languages written in the same script, which
+// the detector cannot tell apart from lang.
+var scriptLanguages = []struct {
+	script *unicode.RangeTable
+	lang   string
+	others []string
+}{
+	{unicode.Hiragana, "ja", nil},
+	{unicode.Katakana, "ja", nil},
+	{unicode.Hangul, "ko", nil},
+	{unicode.Han, "zh", []string{"ja", "yue"}},
+	{unicode.Cyrillic, "ru", []string{"uk", "bg", "sr", "kk", "be", "mk", "mn", "ky", "tg"}},
+	{unicode.Arabic, "ar", []string{"fa", "ur", "ps", "ku", "sd", "ug"}},
+	{unicode.Hebrew, "he", []string{"yi"}},
+	{unicode.Greek, "el", nil},
+	{unicode.Thai, "th", nil},
+	{unicode.Devanagari, "hi", []string{"mr", "ne", "sa"}},
+}
+
+// SharesScript reports whether lang is written in the script the
+// NgramDetector reports as detected, such as fa for ar, ja for zh or zh-Hant
+// for zh. Such a detection is no evidence that the text is not in lang.
+func SharesScript(detected, lang string) bool {
+	detected, lang = language.Base(detected), language.Base(lang)
+	for _, s := range scriptLanguages {
+		if s.lang != detected {
+			continue
+		}
+		if lang == detected {
+			return true
+		}
+		for _, other := range s.others {
+			if other == lang {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NgramDetector is an offline LanguageDetector. Texts in distinctive scripts
+// are identified by script; Latin-script texts are compared against character
+// trigram profiles of common European languages.
+type NgramDetector struct {
+	profiles map[string]map[string]float64 // language -> trigram log probability
+	unseen   map[string]float64            // language -> log probability of an unseen trigram
+}
+
+// NewNgramDetector creates an NgramDetector from the built-in profiles
+func NewNgramDetector() *NgramDetector {
+	d := &NgramDetector{
+		profiles: make(map[string]map[string]float64),
+		unseen:   make(map[string]float64),
+	}
+	for lang, sample := range ngramSamples {
+		counts := make(map[string]int)
+		total := 0
+		for _, tri := range trigrams(sample) {
+			counts[tri]++
+			total++
+		}
+		// Add-one smoothing over the observed vocabulary plus one bucket for
+		// everything unseen
+		denom := float64(total + len(counts) + 1)
+		profile := make(map[string]float64, len(counts))
+		for tri, n := range counts {
+			profile[tri] = math.Log(float64(n+1) / denom)
+		}
+		d.profiles[lang] = profile
+		d.unseen[lang] = math.Log(1 / denom)
+	}
+	return d
+}
+
+// DetectLanguage identifies the language of text
+func (d *NgramDetector) DetectLanguage(ctx context.Context, text string) (string, float64, error) {
+	counts := make(map[string]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			counts["latin"]++
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			counts["ja"]++
+		default:
+			for _, s := range scriptLanguages {
+				if unicode.Is(s.script, r) {
+					counts[s.lang]++
+					break
+				}
+			}
+		}
+	}
+	if letters == 0 {
+		return "", 0, nil
+	}
+
+	// Kana marks Japanese even when most characters are kanji
+	if counts["ja"] > 0 {
+		return "ja", float64(counts["ja"]+counts["zh"]) / float64(letters), nil
+	}
+
+	best, bestCount := "", 0
+	for script, n := range counts {
+		if n > bestCount || (n == bestCount && script < best) {
+			best, bestCount = script, n
+		}
+	}
+	share := float64(bestCount) / float64(letters)
+
+	switch best {
+	case "latin":
+		lang, confidence := d.detectLatin(text)
+		if letters < minDetectLetters {
+			confidence = 0
+		}
+		return lang, confidence * share, nil
+	case "ru":
+		if strings.ContainsAny(strings.ToLower(text), "іїєґ") {
+			return "uk", share, nil
+		}
+	}
+	// Scripts like Han or Cyrillic are identified from a single character
+	// as reliably as from a sentence, so short texts keep their confidence
+	return best, share, nil
+}
+
+// detectLatin scores text against each trigram profile and returns the most
+// likely language with its share of the probability mass
+func (d *NgramDetector) detectLatin(text string) (string, float64) {
+	tris := trigrams(text)
+	if len(tris) == 0 {
+		return "", 0
+	}
+
+	type score struct {
+		lang string
+		logp float64
+	}
+	scores := make([]score, 0, len(d.profiles))
+	for lang, profile := range d.profiles {
+		logp := 0.0
+		for _, tri := range tris {
+			if p, ok := profile[tri]; ok {
+				logp += p
+			} else {
+				logp += d.unseen[lang]
+			}
+		}
+		// Average per trigram so long texts do not make every decision
+		// look certain
+		scores = append(scores, score{lang, logp / float64(len(tris))})
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].logp != scores[j].logp {
+			return scores[i].logp > scores[j].logp
+		}
+		return scores[i].lang < scores[j].lang
+	})
+
+	// Softmax over the per-trigram scores, sharpened so that a clear winner
+	// reaches a high confidence
+	const sharpness = 8
+	sum := 0.0
+	for _, s := range scores {
+		sum += math.Exp(sharpness * (s.logp - scores[0].logp))
+	}
+	return scores[0].lang, 1 / sum
+}
+
+// trigrams returns the character trigrams of text's words, lower-cased and
+// padded with spaces so word starts and ends are distinctive
+func trigrams(text string) []string {
+	var result []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			result = append(result, string(runes[i:i+3]))
+		}
+	}
+	return result
+}
+
+// DetectLanguage identifies the language of text using the chat model
+func (t *OpenAITranslator) DetectLanguage(ctx context.Context, text string) (string, float64, error) {
+	reply, err := t.complete(ctx, []openai.ChatCompletionMessage{
+		{
+			Role: openai.ChatMessageRoleSystem,
+			Content: "Identify the language of the user's message. Reply with its ISO 639-1 code only, " +
+				"such as en, ja or es. If you cannot tell, reply with und.",
+		},
+		{Role: openai.ChatMessageRoleUser, Content: text},
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	lang := strings.ToLower(strings.Trim(strings.TrimSpace(reply), ".\"'`"))
+	if lang == "und" {
+		return "", 0, nil
+	}
+	if len(lang) < 2 || len(lang) > 3 || strings.IndexFunc(lang, func(r rune) bool { return r < 'a' || r > 'z' }) >= 0 {
+		return "", 0, fmt.Errorf("unexpected language code from OpenAI: %q", reply)
+	}
+	return lang, 1, nil
+}
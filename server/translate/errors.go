@@ -0,0 +1,75 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ProviderError describes a failed call to a translation provider
+type ProviderError struct {
+	Provider string
+	// StatusCode is the HTTP status returned by the provider, or zero if no
+	// response was received
+	StatusCode int
+	// RetryAfter is the delay the provider asked for before retrying, if any
+	RetryAfter time.Duration
+	Err        error
+}
+
+// Error returns the error message
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("error calling %s API: %v", e.Provider, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// IsTransient reports whether err is likely to go away if the call is
+// retried: rate limiting, server errors and network failures
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) && providerErr.StatusCode != 0 {
+		return providerErr.StatusCode == http.StatusTooManyRequests ||
+			providerErr.StatusCode == http.StatusRequestTimeout ||
+			providerErr.StatusCode >= 500
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// retryAfterFrom returns the delay an error asks for before retrying
+func retryAfterFrom(err error) time.Duration {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.RetryAfter
+	}
+	return 0
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
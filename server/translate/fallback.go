@@ -0,0 +1,108 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Provider is a named Translator in a FallbackTranslator chain
+type Provider struct {
+	Name       string
+	Translator Translator
+}
+
+// FallbackTranslator tries its providers in order, moving on to the next
+// one when a provider fails or takes longer than the per-provider timeout
+type FallbackTranslator struct {
+	providers []Provider
+	timeout   time.Duration
+}
+
+// NewFallbackTranslator creates a FallbackTranslator. A timeout of zero lets
+// each provider use the caller's whole deadline.
+func NewFallbackTranslator(timeout time.Duration, providers ...Provider) *FallbackTranslator {
+	return &FallbackTranslator{
+		providers: providers,
+		timeout:   timeout,
+	}
+}
+
+// Translate translates text with the first provider that succeeds
+func (f *FallbackTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	return f.do(ctx, func(ctx context.Context, t Translator) (string, error) {
+		return t.Translate(ctx, text, fromLang, toLang)
+	})
+}
+
+// TranslateConversation translates text with the first provider that
+// succeeds, passing conversation context to providers that support it
+func (f *FallbackTranslator) TranslateConversation(ctx context.Context, turns []Turn, text, fromLang, toLang string) (string, error) {
+	return f.do(ctx, func(ctx context.Context, t Translator) (string, error) {
+		if ct, ok := t.(ConversationTranslator); ok {
+			return ct.TranslateConversation(ctx, turns, text, fromLang, toLang)
+		}
+		return t.Translate(ctx, text, fromLang, toLang)
+	})
+}
+
+// TranslateStream streams a translation from the first provider that
+// succeeds; providers without streaming support deliver it all at once
+func (f *FallbackTranslator) TranslateStream(ctx context.Context, turns []Turn, text, fromLang, toLang string, onDelta func(partial string)) (string, error) {
+	return f.do(ctx, func(ctx context.Context, t Translator) (string, error) {
+		return translateStream(ctx, t, turns, text, fromLang, toLang, onDelta)
+	})
+}
+
+// TranslateMulti translates text into several languages with the first
+// provider that succeeds; providers without multi-target support translate
+// one language at a time
+func (f *FallbackTranslator) TranslateMulti(ctx context.Context, text, fromLang string, toLangs []string) (map[string]string, error) {
+	var translations map[string]string
+	_, err := f.do(ctx, func(ctx context.Context, t Translator) (string, error) {
+		var err error
+		translations, err = translateMulti(ctx, t, text, fromLang, toLangs)
+		return "", err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return translations, nil
+}
+
+// do calls each provider in turn until one succeeds
+func (f *FallbackTranslator) do(ctx context.Context, call func(context.Context, Translator) (string, error)) (string, error) {
+	if len(f.providers) == 0 {
+		return "", errors.New("no translation providers configured")
+	}
+
+	var lastErr error
+	for _, provider := range f.providers {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		translated, err := f.call(ctx, provider, call)
+		if err == nil {
+			return translated, nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		log.Printf("Translation provider %s failed: %v", provider.Name, err)
+		lastErr = err
+	}
+	return "", fmt.Errorf("all translation providers failed: %w", lastErr)
+}
+
+// call runs a single provider with the per-provider timeout applied
+func (f *FallbackTranslator) call(ctx context.Context, provider Provider, call func(context.Context, Translator) (string, error)) (string, error) {
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+	return call(ctx, provider.Translator)
+}
@@ -0,0 +1,44 @@
+package translate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Formality is the register a translation should use
+type Formality string
+
+// Formality values. FormalityAuto leaves the register to the translator.
+const (
+	FormalityAuto     Formality = "auto"
+	FormalityFormal   Formality = "formal"
+	FormalityInformal Formality = "informal"
+)
+
+// ParseFormality parses a formality name, ignoring case
+func ParseFormality(name string) (Formality, error) {
+	switch f := Formality(strings.ToLower(strings.TrimSpace(name))); f {
+	case FormalityAuto, FormalityFormal, FormalityInformal:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown formality %q (want formal, informal or auto)", name)
+}
+
+// formalityKey is the context key for the requested formality
+type formalityKey struct{}
+
+// NewFormalityContext returns a copy of ctx asking translators that support
+// it to use formality f
+func NewFormalityContext(ctx context.Context, f Formality) context.Context {
+	return context.WithValue(ctx, formalityKey{}, f)
+}
+
+// FormalityFromContext returns the formality carried by ctx, or FormalityAuto
+// if there is none
+func FormalityFromContext(ctx context.Context) Formality {
+	if f, ok := ctx.Value(formalityKey{}).(Formality); ok && f != "" {
+		return f
+	}
+	return FormalityAuto
+}
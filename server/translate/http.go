@@ -0,0 +1,75 @@
+package translate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBody bounds how much of a failed response is kept in the error
+const maxErrorBody = 4096
+
+// postJSON sends body as JSON to url and decodes the JSON response into out.
+// Failed calls are returned as a *ProviderError.
+func postJSON(ctx context.Context, client *http.Client, provider, url string, header http.Header, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error encoding %s request: %v", provider, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error creating %s request: %v", provider, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doJSON(ctx, client, provider, req, header, out)
+}
+
+// getJSON fetches url and decodes the JSON response into out. Failed calls
+// are returned as a *ProviderError.
+func getJSON(ctx context.Context, client *http.Client, provider, url string, header http.Header, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("error creating %s request: %v", provider, err)
+	}
+	return doJSON(ctx, client, provider, req, header, out)
+}
+
+// doJSON sends req with header added and decodes the JSON response into out
+func doJSON(ctx context.Context, client *http.Client, provider string, req *http.Request, header http.Header, out interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &ProviderError{Provider: provider, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return &ProviderError{
+			Provider:   provider,
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+			Err:        fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(detail))),
+		}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return &ProviderError{Provider: provider, StatusCode: resp.StatusCode, Err: fmt.Errorf("invalid response: %v", err)}
+	}
+	return nil
+}
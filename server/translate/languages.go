@@ -0,0 +1,148 @@
+package translate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"shabe/server/language"
+)
+
+// LanguageLister is implemented by translators that can report the language
+// tags they translate into. Tags are returned as the provider spells them.
+type LanguageLister interface {
+	Languages(ctx context.Context) ([]string, error)
+}
+
+// supportedLanguages asks t for its languages, assuming translators that
+// cannot tell support every language the language package knows
+func supportedLanguages(ctx context.Context, t Translator) ([]string, error) {
+	if lister, ok := t.(LanguageLister); ok {
+		return lister.Languages(ctx)
+	}
+	return allLanguages(), nil
+}
+
+// allLanguages returns the code of every language the language package knows
+func allLanguages() []string {
+	all := language.All()
+	codes := make([]string, len(all))
+	for i, lang := range all {
+		codes[i] = lang.Code
+	}
+	return codes
+}
+
+// Languages returns every known language, since the chat model is not
+// limited to a fixed set
+func (t *OpenAITranslator) Languages(ctx context.Context) ([]string, error) {
+	return allLanguages(), nil
+}
+
+// Languages returns the target languages DeepL supports
+func (t *DeepLTranslator) Languages(ctx context.Context) ([]string, error) {
+	header := http.Header{}
+	header.Set("Authorization", "DeepL-Auth-Key "+t.config.APIKey)
+
+	var resp []struct {
+		Language string `json:"language"`
+	}
+	if err := getJSON(ctx, t.config.HTTPClient, "DeepL", t.config.BaseURL+"/v2/languages?type=target", header, &resp); err != nil {
+		return nil, err
+	}
+	tags := make([]string, len(resp))
+	for i, lang := range resp {
+		tags[i] = lang.Language
+	}
+	return tags, nil
+}
+
+// Languages returns the languages Google Cloud Translation supports
+func (t *GoogleTranslator) Languages(ctx context.Context) ([]string, error) {
+	var resp struct {
+		Data struct {
+			Languages []struct {
+				Language string `json:"language"`
+			} `json:"languages"`
+		} `json:"data"`
+	}
+	if err := getJSON(ctx, t.config.HTTPClient, "Google Translate", t.config.BaseURL+"/language/translate/v2/languages", t.header(), &resp); err != nil {
+		return nil, err
+	}
+	tags := make([]string, len(resp.Data.Languages))
+	for i, lang := range resp.Data.Languages {
+		tags[i] = lang.Language
+	}
+	return tags, nil
+}
+
+// Languages returns the languages the LibreTranslate server supports
+func (t *LibreTranslateTranslator) Languages(ctx context.Context) ([]string, error) {
+	var resp []struct {
+		Code string `json:"code"`
+	}
+	if err := getJSON(ctx, t.config.HTTPClient, "LibreTranslate", t.config.URL+"/languages", nil, &resp); err != nil {
+		return nil, err
+	}
+	tags := make([]string, len(resp))
+	for i, lang := range resp {
+		tags[i] = lang.Code
+	}
+	return tags, nil
+}
+
+// Languages returns the languages Azure Translator supports
+func (t *AzureTranslator) Languages(ctx context.Context) ([]string, error) {
+	var resp struct {
+		Translation map[string]struct{} `json:"translation"`
+	}
+	endpoint := t.config.Endpoint + "/languages?api-version=3.0&scope=translation"
+	if err := getJSON(ctx, t.config.HTTPClient, "Azure Translator", endpoint, nil, &resp); err != nil {
+		return nil, err
+	}
+	tags := make([]string, 0, len(resp.Translation))
+	for tag := range resp.Translation {
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// Languages returns the languages of the wrapped translator
+func (m *MaskingTranslator) Languages(ctx context.Context) ([]string, error) {
+	return supportedLanguages(ctx, m.next)
+}
+
+// Languages returns the languages of the wrapped translator
+func (c *CachingTranslator) Languages(ctx context.Context) ([]string, error) {
+	return supportedLanguages(ctx, c.next)
+}
+
+// Languages returns the languages of the wrapped translator
+func (r *ResilientTranslator) Languages(ctx context.Context) ([]string, error) {
+	return supportedLanguages(ctx, r.next)
+}
+
+// Languages returns the languages any provider supports, skipping providers
+// that cannot be reached
+func (f *FallbackTranslator) Languages(ctx context.Context) ([]string, error) {
+	seen := make(map[string]bool)
+	var tags []string
+	var lastErr error
+	for _, provider := range f.providers {
+		providerTags, err := supportedLanguages(ctx, provider.Translator)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, tag := range providerTags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	if tags == nil && lastErr != nil {
+		return nil, fmt.Errorf("no translation provider listed its languages: %w", lastErr)
+	}
+	return tags, nil
+}
@@ -0,0 +1,70 @@
+package translate
+
+import (
+	"context"
+	"time"
+)
+
+// LegacyTranslator is the translator signature used before translation calls
+// took a context. New code should implement Translator instead.
+type LegacyTranslator interface {
+	Translate(text, fromLang, toLang string) (string, error)
+}
+
+// FromLegacy adapts a LegacyTranslator to the Translator interface. The
+// wrapped call cannot be interrupted, but the adapter returns as soon as the
+// context is done and discards the late result.
+func FromLegacy(t LegacyTranslator) Translator {
+	return legacyTranslator{t}
+}
+
+type legacyTranslator struct {
+	LegacyTranslator
+}
+
+type translateResult struct {
+	text string
+	err  error
+}
+
+// Translate runs the legacy translation, returning early if ctx is done
+func (l legacyTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	done := make(chan translateResult, 1)
+	go func() {
+		translated, err := l.LegacyTranslator.Translate(text, fromLang, toLang)
+		done <- translateResult{translated, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case r := <-done:
+		return r.text, r.err
+	}
+}
+
+// ToLegacy adapts a Translator for callers that use the legacy signature.
+// Each call gets its own deadline of timeout; zero means no deadline.
+func ToLegacy(t Translator, timeout time.Duration) LegacyTranslator {
+	return contextTranslator{translator: t, timeout: timeout}
+}
+
+type contextTranslator struct {
+	translator Translator
+	timeout    time.Duration
+}
+
+// Translate calls the wrapped translator with a fresh context
+func (c contextTranslator) Translate(text, fromLang, toLang string) (string, error) {
+	ctx := context.Background()
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	return c.translator.Translate(ctx, text, fromLang, toLang)
+}
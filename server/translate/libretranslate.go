@@ -0,0 +1,65 @@
+package translate
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// LibreTranslateConfig holds the LibreTranslateTranslator configuration
+type LibreTranslateConfig struct {
+	// URL is the server's base URL, e.g. http://localhost:5000
+	URL string
+	// APIKey is only needed for servers that require one
+	APIKey     string
+	HTTPClient *http.Client
+}
+
+// LibreTranslateTranslator implements the Translator interface using a
+// LibreTranslate server
+type LibreTranslateTranslator struct {
+	config LibreTranslateConfig
+}
+
+// NewLibreTranslateTranslator creates a new LibreTranslateTranslator
+func NewLibreTranslateTranslator(cfg LibreTranslateConfig) *LibreTranslateTranslator {
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	return &LibreTranslateTranslator{config: cfg}
+}
+
+type libreTranslateRequest struct {
+	Q      string `json:"q"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Format string `json:"format"`
+	APIKey string `json:"api_key,omitempty"`
+}
+
+type libreTranslateResponse struct {
+	TranslatedText string `json:"translatedText"`
+}
+
+// Translate translates text from one language to another using LibreTranslate
+func (t *LibreTranslateTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	if fromLang == toLang {
+		return text, nil
+	}
+
+	source := fromLang
+	if source == "" {
+		source = "auto"
+	}
+
+	var resp libreTranslateResponse
+	err := postJSON(ctx, t.config.HTTPClient, "LibreTranslate", t.config.URL+"/translate", nil, libreTranslateRequest{
+		Q:      text,
+		Source: source,
+		Target: toLang,
+		Format: "text",
+		APIKey: t.config.APIKey,
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.TranslatedText, nil
+}
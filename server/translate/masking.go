@@ -0,0 +1,128 @@
+package translate
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"shabe/server/glossary"
+)
+
+// placeholderPattern matches the placeholders maskTerms puts in the text,
+// tolerating spaces that providers sometimes insert
+var placeholderPattern = regexp.MustCompile(`⟦\s*(\d+)\s*⟧`)
+
+// MaskingTranslator enforces the glossary carried in the context for
+// classical MT providers, which cannot be told about it in a prompt. Glossary
+// terms are replaced with placeholders before translation and the placeholders
+// are replaced with the forced translations, or the original text for
+// do-not-translate terms, afterwards.
+type MaskingTranslator struct {
+	next Translator
+}
+
+// NewMaskingTranslator creates a MaskingTranslator in front of next
+func NewMaskingTranslator(next Translator) *MaskingTranslator {
+	return &MaskingTranslator{next: next}
+}
+
+// Translate translates text, keeping glossary terms as configured
+func (m *MaskingTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	g := glossary.FromContext(ctx).For(fromLang, toLang)
+	if g.IsEmpty() || fromLang == toLang {
+		return m.next.Translate(ctx, text, fromLang, toLang)
+	}
+
+	masked, replacements := maskTerms(text, g)
+	if len(replacements) == 0 {
+		return m.next.Translate(ctx, text, fromLang, toLang)
+	}
+
+	translated, err := m.next.Translate(ctx, masked, fromLang, toLang)
+	if err != nil {
+		return "", err
+	}
+	return unmaskTerms(translated, replacements), nil
+}
+
+// maskTerms replaces every glossary term in text with a numbered placeholder
+// and returns what each placeholder should become in the translation
+func maskTerms(text string, g glossary.Glossary) (string, []string) {
+	type entry struct {
+		source string
+		target string // empty keeps the matched text
+	}
+	var entries []entry
+	for _, t := range g.Terms {
+		entries = append(entries, entry{source: t.Source, target: t.Target})
+	}
+	for _, term := range g.DoNotTranslate {
+		entries = append(entries, entry{source: term})
+	}
+	// Prefer the longest match when terms overlap
+	sort.SliceStable(entries, func(i, j int) bool {
+		return len(entries[i].source) > len(entries[j].source)
+	})
+
+	patterns := make([]string, len(entries))
+	for i, e := range entries {
+		patterns[i] = "(" + termPattern(e.source) + ")"
+	}
+	re := regexp.MustCompile("(?i)" + strings.Join(patterns, "|"))
+
+	var replacements []string
+	var b strings.Builder
+	last := 0
+	for _, match := range re.FindAllStringSubmatchIndex(text, -1) {
+		for i, e := range entries {
+			start := match[2*(i+1)]
+			if start < 0 {
+				continue
+			}
+			replacement := e.target
+			if replacement == "" {
+				replacement = text[match[0]:match[1]]
+			}
+			b.WriteString(text[last:match[0]])
+			fmt.Fprintf(&b, "⟦%d⟧", len(replacements))
+			replacements = append(replacements, replacement)
+			last = match[1]
+			break
+		}
+	}
+	b.WriteString(text[last:])
+	return b.String(), replacements
+}
+
+// unmaskTerms replaces the placeholders in a translation
+func unmaskTerms(text string, replacements []string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		n, err := strconv.Atoi(placeholderPattern.FindStringSubmatch(placeholder)[1])
+		if err != nil || n >= len(replacements) {
+			return placeholder
+		}
+		return replacements[n]
+	})
+}
+
+// termPattern matches a term as a whole word where the term starts or ends
+// with a letter or digit; scripts without spaces match anywhere
+func termPattern(term string) string {
+	pattern := regexp.QuoteMeta(term)
+	if first, _ := utf8.DecodeRuneInString(term); first < utf8.RuneSelf && isWordRune(first) {
+		pattern = `\b` + pattern
+	}
+	if last, _ := utf8.DecodeLastRuneInString(term); last < utf8.RuneSelf && isWordRune(last) {
+		pattern += `\b`
+	}
+	return pattern
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,205 @@
+package translate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+	"shabe/server/glossary"
+	"shabe/server/language"
+)
+
+// MultiTranslator is implemented by translators that can translate a text
+// into several languages at once. The result holds a translation for every
+// language in toLangs; a language equal to fromLang maps to text itself.
+type MultiTranslator interface {
+	Translator
+	TranslateMulti(ctx context.Context, text, fromLang string, toLangs []string) (map[string]string, error)
+}
+
+// translateMulti translates with t's multi-target support if it has any and
+// one language at a time otherwise
+func translateMulti(ctx context.Context, t Translator, text, fromLang string, toLangs []string) (map[string]string, error) {
+	if mt, ok := t.(MultiTranslator); ok {
+		return mt.TranslateMulti(ctx, text, fromLang, toLangs)
+	}
+	return translateEach(ctx, t, text, fromLang, toLangs)
+}
+
+// translateEach translates text into each language concurrently with
+// separate calls, failing if any of them fails
+func translateEach(ctx context.Context, t Translator, text, fromLang string, toLangs []string) (map[string]string, error) {
+	translations := make(map[string]string, len(toLangs))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	for _, lang := range toLangs {
+		if lang == fromLang {
+			mu.Lock()
+			translations[lang] = text
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(lang string) {
+			defer wg.Done()
+			translated, err := t.Translate(ctx, text, fromLang, lang)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			translations[lang] = translated
+		}(lang)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return translations, nil
+}
+
+// TranslateMulti translates text into every language in toLangs with a
+// single completion that returns the translations as a JSON object.
+// Languages the reply leaves out or garbles are translated one at a time, as
+// are all of them when the glossary differs between target languages.
+func (t *OpenAITranslator) TranslateMulti(ctx context.Context, text, fromLang string, toLangs []string) (map[string]string, error) {
+	translations := make(map[string]string, len(toLangs))
+	var targets []string
+	for _, lang := range toLangs {
+		if lang == fromLang {
+			translations[lang] = text
+		} else if _, seen := translations[lang]; !seen {
+			translations[lang] = ""
+			targets = append(targets, lang)
+		}
+	}
+	if len(targets) == 0 {
+		return translations, nil
+	}
+	if len(targets) == 1 || !sharedGlossary(glossary.FromContext(ctx), fromLang, targets) {
+		return t.translateEach(ctx, translations, text, fromLang, targets)
+	}
+
+	data := promptData(ctx, text, fromLang, targets[0])
+	names := make([]string, len(targets))
+	for i, lang := range targets {
+		names[i] = language.Name(lang)
+	}
+	data.To = strings.Join(targets, ", ")
+	data.ToName = strings.Join(names, ", ")
+	system, user, err := t.config.Prompt.render(data)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := t.completeRequest(ctx, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: system + "\n\n" + multiFormatInstruction(targets)},
+			{Role: openai.ChatMessageRoleUser, Content: user},
+		},
+		MaxTokens:      t.config.MaxTokens * len(targets),
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := parseMultiReply(reply)
+	var missing []string
+	for _, lang := range targets {
+		translated, ok := lookupLang(parsed, lang)
+		if !ok {
+			missing = append(missing, lang)
+			continue
+		}
+		translations[lang] = sanitizeOutput(translated, text)
+	}
+	if len(missing) > 0 {
+		log.Printf("OpenAI reply lacked translations into %s, translating them separately", strings.Join(missing, ", "))
+		return t.translateEach(ctx, translations, text, fromLang, missing)
+	}
+	return translations, nil
+}
+
+// translateEach fills in translations for langs with one request per language
+func (t *OpenAITranslator) translateEach(ctx context.Context, translations map[string]string, text, fromLang string, langs []string) (map[string]string, error) {
+	rest, err := translateEach(ctx, t, text, fromLang, langs)
+	if err != nil {
+		return nil, err
+	}
+	for lang, translated := range rest {
+		translations[lang] = translated
+	}
+	return translations, nil
+}
+
+// multiFormatInstruction tells the model how to lay out a multi-target reply
+func multiFormatInstruction(langs []string) string {
+	keys := make([]string, len(langs))
+	for i, lang := range langs {
+		keys[i] = fmt.Sprintf("%q", lang)
+	}
+	return "Reply with a JSON object whose keys are exactly the language codes " + strings.Join(keys, ", ") +
+		" and whose values are the translation into that language as a plain string. " +
+		"Do not include any other keys or any text outside the JSON object."
+}
+
+// parseMultiReply extracts the language to translation pairs from a
+// multi-target reply, tolerating code fences around the JSON. Values that
+// are not non-empty strings are dropped; a reply that is not a JSON object
+// yields nil.
+func parseMultiReply(reply string) map[string]string {
+	start := strings.Index(reply, "{")
+	end := strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return nil
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &raw); err != nil {
+		return nil
+	}
+	result := make(map[string]string, len(raw))
+	for lang, value := range raw {
+		var translated string
+		if err := json.Unmarshal(value, &translated); err != nil || strings.TrimSpace(translated) == "" {
+			continue
+		}
+		result[lang] = translated
+	}
+	return result
+}
+
+// lookupLang finds lang in a parsed reply, ignoring case since models
+// sometimes capitalize region subtags differently
+func lookupLang(parsed map[string]string, lang string) (string, bool) {
+	if translated, ok := parsed[lang]; ok {
+		return translated, true
+	}
+	for key, translated := range parsed {
+		if strings.EqualFold(key, lang) {
+			return translated, true
+		}
+	}
+	return "", false
+}
+
+// sharedGlossary reports whether the same glossary entries apply to every
+// target language, so a single prompt can carry them
+func sharedGlossary(g glossary.Glossary, fromLang string, toLangs []string) bool {
+	first := g.For(fromLang, toLangs[0])
+	for _, lang := range toLangs[1:] {
+		if !reflect.DeepEqual(first, g.For(fromLang, lang)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package translate
+
+// ngramSamples are short texts of everyday meeting language from which the
+// NgramDetector builds its trigram profiles
+var ngramSamples = map[string]string{
+	"en": `Good morning everyone, thanks for joining the meeting today. Can you hear me?
+I think we should start with the status update and then talk about the next release.
+What do you think about the new design? It looks good to me, but we still have some
+questions about the timeline. Could you share your screen so that we can see the
+numbers? We were planning to finish the project by the end of the month, although the
+team is waiting for feedback from the customer. Let me know if there is anything I can
+do to help. I will send the notes after the call. That was all from my side, thank you
+very much. Does anyone have other questions before we wrap up? See you next week.
+The weather has been nice, and my family went to the beach on the weekend with friends.`,
+
+	"es": `Buenos días a todos, gracias por unirse a la reunión de hoy. ¿Me escuchan bien?
+Creo que deberíamos empezar con la actualización del estado y después hablar de la
+próxima versión. ¿Qué opinan del nuevo diseño? A mí me parece bien, pero todavía
+tenemos algunas preguntas sobre el calendario. ¿Puedes compartir tu pantalla para que
+podamos ver los números? Pensábamos terminar el proyecto a finales de mes, aunque el
+equipo está esperando los comentarios del cliente. Avísame si hay algo que pueda hacer
+para ayudar. Enviaré las notas después de la llamada. Eso es todo por mi parte, muchas
+gracias. ¿Alguien tiene otras preguntas antes de terminar? Nos vemos la próxima semana.
+El tiempo ha sido bueno y mi familia fue a la playa el fin de semana con unos amigos.`,
+
+	"fr": `Bonjour à tous, merci d'avoir rejoint la réunion aujourd'hui. Vous m'entendez bien ?
+Je pense que nous devrions commencer par le point d'avancement, puis parler de la
+prochaine version. Que pensez-vous du nouveau design ? Il me semble bien, mais nous
+avons encore quelques questions sur le calendrier. Peux-tu partager ton écran pour que
+nous puissions voir les chiffres ? Nous avions prévu de terminer le projet à la fin du
+mois, même si l'équipe attend les retours du client. Dis-moi s'il y a quelque chose que
+je peux faire pour aider. J'enverrai les notes après l'appel. C'est tout de mon côté,
+merci beaucoup. Est-ce que quelqu'un a d'autres questions avant de terminer ? À la
+semaine prochaine. Il a fait beau et ma famille est allée à la plage ce week-end.`,
+
+	"de": `Guten Morgen zusammen, danke, dass ihr heute an dem Meeting teilnehmt. Könnt ihr
+mich hören? Ich denke, wir sollten mit dem Statusbericht anfangen und dann über die
+nächste Version sprechen. Was haltet ihr von dem neuen Design? Es sieht für mich gut
+aus, aber wir haben noch einige Fragen zum Zeitplan. Kannst du deinen Bildschirm teilen,
+damit wir die Zahlen sehen können? Wir wollten das Projekt bis Ende des Monats
+abschließen, obwohl das Team noch auf Rückmeldung vom Kunden wartet. Sag mir Bescheid,
+wenn ich irgendwie helfen kann. Ich schicke die Notizen nach dem Anruf. Das war alles
+von meiner Seite, vielen Dank. Hat noch jemand Fragen, bevor wir aufhören? Bis nächste
+Woche. Das Wetter war schön und meine Familie war am Wochenende mit Freunden am Strand.`,
+
+	"it": `Buongiorno a tutti, grazie per aver partecipato alla riunione di oggi. Mi sentite?
+Penso che dovremmo iniziare con l'aggiornamento sullo stato e poi parlare della
+prossima versione. Cosa ne pensate del nuovo design? A me sembra buono, ma abbiamo
+ancora alcune domande sulla tempistica. Puoi condividere lo schermo così possiamo
+vedere i numeri? Pensavamo di finire il progetto entro la fine del mese, anche se la
+squadra sta aspettando il riscontro del cliente. Fammi sapere se c'è qualcosa che posso
+fare per aiutare. Manderò gli appunti dopo la chiamata. Questo è tutto da parte mia,
+grazie mille. Qualcuno ha altre domande prima di chiudere? Ci vediamo la prossima
+settimana. Il tempo è stato bello e la mia famiglia è andata al mare nel fine settimana.`,
+
+	"pt": `Bom dia a todos, obrigado por participarem da reunião de hoje. Vocês me ouvem bem?
+Acho que devemos começar com a atualização do status e depois falar sobre a próxima
+versão. O que vocês acham do novo design? Para mim parece bom, mas ainda temos algumas
+perguntas sobre o cronograma. Você pode compartilhar a sua tela para que possamos ver
+os números? Estávamos planejando terminar o projeto até o fim do mês, embora a equipe
+esteja esperando o retorno do cliente. Me avise se houver algo que eu possa fazer para
+ajudar. Vou enviar as notas depois da chamada. Isso é tudo da minha parte, muito
+obrigado. Alguém tem outras perguntas antes de encerrarmos? Até a próxima semana.
+O tempo estava ótimo e a minha família foi à praia no fim de semana com uns amigos.`,
+
+	"nl": `Goedemorgen allemaal, bedankt dat jullie vandaag bij de vergadering zijn. Kunnen
+jullie mij horen? Ik denk dat we moeten beginnen met de statusupdate en daarna over de
+volgende versie moeten praten. Wat vinden jullie van het nieuwe ontwerp? Het ziet er
+goed uit, maar we hebben nog een paar vragen over de planning. Kun je je scherm delen
+zodat we de cijfers kunnen zien? We waren van plan het project aan het einde van de
+maand af te ronden, hoewel het team nog wacht op feedback van de klant. Laat het me
+weten als ik ergens mee kan helpen. Ik stuur de aantekeningen na het gesprek. Dat was
+alles van mijn kant, hartelijk dank. Heeft iemand nog andere vragen voordat we stoppen?
+Tot volgende week. Het weer was mooi en mijn familie is in het weekend naar het strand
+geweest met vrienden.`,
+}
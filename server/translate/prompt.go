@@ -0,0 +1,118 @@
+package translate
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"shabe/server/glossary"
+	"shabe/server/language"
+)
+
+// DefaultSystemPrompt is the system prompt template used when none is configured
+const DefaultSystemPrompt = `You are a professional interpreter translating a live meeting from {{.FromName}} to {{.ToName}}.
+{{- if .Conversation}} Use the earlier turns only as context to resolve pronouns, ellipses and terminology.{{end}}
+{{- if eq .Formality "formal"}} Use a formal, polite register, such as keigo in Japanese, jondaenmal in Korean or Sie in German.{{end}}
+{{- if eq .Formality "informal"}} Use a casual register, as between close colleagues, such as plain forms in Japanese and Korean or du in German.{{end}}
+
+{{- if .Glossary}}
+Always translate these terms as given:
+{{- range .Glossary}}
+- {{.Source}} → {{.Target}}
+{{- end}}
+{{- end}}
+{{- if .DoNotTranslate}}
+Keep these terms exactly as written, without translating them: {{join .DoNotTranslate ", "}}
+{{- end}}
+Reply with the translation of the latest message only, without quotes, notes or explanations.`
+
+// DefaultUserPrompt is the user prompt template used when none is configured
+const DefaultUserPrompt = `{{.Text}}`
+
+// PromptData is the data available to prompt templates
+type PromptData struct {
+	From string
+	To   string
+	// FromName and ToName are the English names of From and To, such as
+	// "Portuguese (Brazil)"
+	FromName string
+	ToName   string
+	Text     string
+	// Conversation is true when earlier turns are sent as context
+	Conversation bool
+	// Formality is the register to use: formal, informal or auto
+	Formality Formality
+	// Glossary and DoNotTranslate hold the glossary entries that apply
+	Glossary       []glossary.Term
+	DoNotTranslate []string
+}
+
+// promptFuncs are the functions available to prompt templates
+var promptFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// Prompt holds the parsed system and user prompt templates sent to LLM
+// translators
+type Prompt struct {
+	system *template.Template
+	user   *template.Template
+}
+
+// ParsePrompt parses system and user prompt templates written in Go's
+// text/template syntax. Empty templates fall back to the defaults.
+func ParsePrompt(system, user string) (*Prompt, error) {
+	if strings.TrimSpace(system) == "" {
+		system = DefaultSystemPrompt
+	}
+	if strings.TrimSpace(user) == "" {
+		user = DefaultUserPrompt
+	}
+
+	systemTmpl, err := template.New("system").Funcs(promptFuncs).Option("missingkey=error").Parse(system)
+	if err != nil {
+		return nil, fmt.Errorf("invalid system prompt: %v", err)
+	}
+	userTmpl, err := template.New("user").Funcs(promptFuncs).Option("missingkey=error").Parse(user)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user prompt: %v", err)
+	}
+
+	p := &Prompt{system: systemTmpl, user: userTmpl}
+	// Catch references to unknown fields now rather than on the first message
+	if _, _, err := p.render(PromptData{From: "en", To: "ja", Text: "hello"}); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// DefaultPrompt returns the default prompt templates
+func DefaultPrompt() *Prompt {
+	p, err := ParsePrompt(DefaultSystemPrompt, DefaultUserPrompt)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// render executes both templates, filling in missing language names
+func (p *Prompt) render(data PromptData) (system, user string, err error) {
+	if data.FromName == "" {
+		data.FromName = language.Name(data.From)
+	}
+	if data.ToName == "" {
+		data.ToName = language.Name(data.To)
+	}
+
+	var b strings.Builder
+	if err := p.system.Execute(&b, data); err != nil {
+		return "", "", fmt.Errorf("error rendering system prompt: %v", err)
+	}
+	system = strings.TrimSpace(b.String())
+
+	b.Reset()
+	if err := p.user.Execute(&b, data); err != nil {
+		return "", "", fmt.Errorf("error rendering user prompt: %v", err)
+	}
+	return system, b.String(), nil
+}
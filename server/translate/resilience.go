@@ -0,0 +1,256 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned while the circuit breaker is rejecting calls
+var ErrCircuitOpen = errors.New("translation temporarily unavailable")
+
+// ResilienceOptions configures a ResilientTranslator
+type ResilienceOptions struct {
+	// MaxRetries is how many times a transient failure is retried
+	MaxRetries int
+	// BaseDelay is the backoff before the first retry; it doubles on each
+	// further retry up to MaxDelay, with random jitter
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// FailureThreshold is the number of consecutive failed calls that opens
+	// the circuit; zero disables the circuit breaker
+	FailureThreshold int
+	// OpenDuration is how long the circuit stays open before a trial call
+	OpenDuration time.Duration
+}
+
+// DefaultResilienceOptions returns sensible defaults for interactive use
+func DefaultResilienceOptions() ResilienceOptions {
+	return ResilienceOptions{
+		MaxRetries:       2,
+		BaseDelay:        200 * time.Millisecond,
+		MaxDelay:         5 * time.Second,
+		FailureThreshold: 5,
+		OpenDuration:     30 * time.Second,
+	}
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// ResilientTranslator wraps a Translator with retries and a circuit breaker
+type ResilientTranslator struct {
+	next Translator
+	opts ResilienceOptions
+
+	mu            sync.Mutex
+	state         circuitState
+	failures      int
+	openedAt      time.Time
+	onStateChange func(degraded bool)
+}
+
+// NewResilientTranslator creates a ResilientTranslator in front of next
+func NewResilientTranslator(next Translator, opts ResilienceOptions) *ResilientTranslator {
+	return &ResilientTranslator{
+		next: next,
+		opts: opts,
+	}
+}
+
+// OnStateChange registers a function that is called whenever the translator
+// becomes degraded (circuit open) or recovers
+func (r *ResilientTranslator) OnStateChange(fn func(degraded bool)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onStateChange = fn
+}
+
+// Degraded reports whether the circuit is open and calls are being rejected
+func (r *ResilientTranslator) Degraded() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state != circuitClosed
+}
+
+// Translate translates text, retrying transient failures
+func (r *ResilientTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	return r.do(ctx, func(ctx context.Context) (string, error) {
+		return r.next.Translate(ctx, text, fromLang, toLang)
+	})
+}
+
+// TranslateConversation translates text with conversation context, retrying
+// transient failures. Wrapped translators without context support are
+// called without it.
+func (r *ResilientTranslator) TranslateConversation(ctx context.Context, turns []Turn, text, fromLang, toLang string) (string, error) {
+	ct, ok := r.next.(ConversationTranslator)
+	if !ok {
+		return r.Translate(ctx, text, fromLang, toLang)
+	}
+	return r.do(ctx, func(ctx context.Context) (string, error) {
+		return ct.TranslateConversation(ctx, turns, text, fromLang, toLang)
+	})
+}
+
+// TranslateStream streams a translation, retrying transient failures. A
+// retried stream starts over from the beginning.
+func (r *ResilientTranslator) TranslateStream(ctx context.Context, turns []Turn, text, fromLang, toLang string, onDelta func(partial string)) (string, error) {
+	return r.do(ctx, func(ctx context.Context) (string, error) {
+		return translateStream(ctx, r.next, turns, text, fromLang, toLang, onDelta)
+	})
+}
+
+// TranslateMulti translates text into several languages, retrying transient
+// failures
+func (r *ResilientTranslator) TranslateMulti(ctx context.Context, text, fromLang string, toLangs []string) (map[string]string, error) {
+	var translations map[string]string
+	_, err := r.do(ctx, func(ctx context.Context) (string, error) {
+		var err error
+		translations, err = translateMulti(ctx, r.next, text, fromLang, toLangs)
+		return "", err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return translations, nil
+}
+
+// do runs call through the circuit breaker, retrying transient failures with
+// jittered exponential backoff or the delay the provider asked for. The
+// circuit breaker counts the call as a single failure once its retries are
+// used up.
+func (r *ResilientTranslator) do(ctx context.Context, call func(context.Context) (string, error)) (string, error) {
+	if !r.allow() {
+		return "", ErrCircuitOpen
+	}
+
+	for attempt := 0; ; attempt++ {
+		translated, err := call(ctx)
+		if err == nil {
+			r.recordResult(true)
+			return translated, nil
+		}
+		if !IsTransient(err) || ctx.Err() != nil {
+			// Errors caused by the request itself say nothing about the
+			// provider's health
+			r.release()
+			return "", err
+		}
+
+		if attempt >= r.opts.MaxRetries {
+			r.recordResult(false)
+			return "", err
+		}
+
+		delay := r.backoff(attempt)
+		if retryAfter := retryAfterFrom(err); retryAfter > delay {
+			delay = retryAfter
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			r.recordResult(false)
+			return "", err
+		}
+
+		log.Printf("Translation attempt %d failed, retrying in %v: %v", attempt+1, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			r.release()
+			return "", ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the jittered delay before retry number attempt+1
+func (r *ResilientTranslator) backoff(attempt int) time.Duration {
+	delay := r.opts.BaseDelay << attempt
+	if delay <= 0 || (r.opts.MaxDelay > 0 && delay > r.opts.MaxDelay) {
+		delay = r.opts.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// Full jitter between half and the whole delay
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// allow reports whether a call may proceed. After OpenDuration an open
+// circuit lets a single trial call through.
+func (r *ResilientTranslator) allow() bool {
+	if r.opts.FailureThreshold <= 0 {
+		return true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch r.state {
+	case circuitOpen:
+		if time.Since(r.openedAt) < r.opts.OpenDuration {
+			return false
+		}
+		r.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		// A trial call is already in flight
+		return false
+	default:
+		return true
+	}
+}
+
+// release lets another trial call through after one ended without telling
+// us anything about the provider's health
+func (r *ResilientTranslator) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state == circuitHalfOpen {
+		r.state = circuitOpen
+		r.openedAt = time.Time{}
+	}
+}
+
+// recordResult updates the circuit breaker with the outcome of a call
+func (r *ResilientTranslator) recordResult(success bool) {
+	if r.opts.FailureThreshold <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	wasDegraded := r.state != circuitClosed
+	if success {
+		r.failures = 0
+		r.state = circuitClosed
+	} else {
+		r.failures++
+		if r.state == circuitHalfOpen || r.failures >= r.opts.FailureThreshold {
+			r.state = circuitOpen
+			r.openedAt = time.Now()
+		}
+	}
+	degraded := r.state != circuitClosed
+	notify := r.onStateChange
+	r.mu.Unlock()
+
+	if degraded != wasDegraded {
+		if degraded {
+			log.Printf("⚠️  Translation circuit opened after %d consecutive failures", r.opts.FailureThreshold)
+		} else {
+			log.Printf("Translation circuit closed, provider recovered")
+		}
+		if notify != nil {
+			notify(degraded)
+		}
+	}
+}
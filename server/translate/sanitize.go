@@ -0,0 +1,68 @@
+package translate
+
+import (
+	"regexp"
+	"strings"
+)
+
+// preamblePattern matches introductions models sometimes put before the
+// translation, such as "Sure! Here is the translation:" or "Translation:"
+var preamblePattern = regexp.MustCompile(`(?i)^(?:(?:sure|certainly|of course|okay|ok)[!,.]?\s*)?` +
+	`(?:here(?:'s| is) (?:the |your |my )?(?:translation|translated text)[^:\n]*|translation(?: \([^)\n]*\))?|translated text)\s*:\s*`)
+
+// notePattern matches explanations models sometimes append after a blank line
+var notePattern = regexp.MustCompile(`(?is)\n\s*\n\s*\(?(?:note|explanation)\b.*$`)
+
+// quotePairs are the quotation marks stripped from around a whole reply
+var quotePairs = [][2]string{
+	{`"`, `"`},
+	{`'`, `'`},
+	{"“", "”"},
+	{"‘", "’"},
+	{"«", "»"},
+	{"「", "」"},
+	{"『", "』"},
+}
+
+// sanitizeOutput removes preambles, trailing notes and wrapping quotes that
+// a model added around the translation of source
+func sanitizeOutput(output, source string) string {
+	cleaned := strings.TrimSpace(output)
+	cleaned = preamblePattern.ReplaceAllString(cleaned, "")
+	cleaned = notePattern.ReplaceAllString(cleaned, "")
+	cleaned = strings.TrimSpace(cleaned)
+
+	source = strings.TrimSpace(source)
+	for _, q := range quotePairs {
+		if isWrapped(cleaned, q) && !isQuoted(source) {
+			cleaned = strings.TrimSpace(cleaned[len(q[0]) : len(cleaned)-len(q[1])])
+			break
+		}
+	}
+
+	if cleaned == "" {
+		// Never turn a reply into nothing
+		return strings.TrimSpace(output)
+	}
+	return cleaned
+}
+
+// isWrapped reports whether s starts and ends with the given quotes and
+// contains no further quotes of the same kind
+func isWrapped(s string, q [2]string) bool {
+	if len(s) < len(q[0])+len(q[1]) || !strings.HasPrefix(s, q[0]) || !strings.HasSuffix(s, q[1]) {
+		return false
+	}
+	inner := s[len(q[0]) : len(s)-len(q[1])]
+	return !strings.Contains(inner, q[0]) && !strings.Contains(inner, q[1])
+}
+
+// isQuoted reports whether s is itself wrapped in any kind of quotes
+func isQuoted(s string) bool {
+	for _, q := range quotePairs {
+		if isWrapped(s, q) {
+			return true
+		}
+	}
+	return false
+}
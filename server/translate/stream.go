@@ -0,0 +1,121 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// StreamingTranslator is implemented by translators that can deliver a
+// translation while it is being produced. onDelta is called with the whole
+// translation so far each time it grows; the final translation is returned.
+// Wrapping translators that retry or fall back may start over, in which case
+// onDelta receives a shorter text than before.
+type StreamingTranslator interface {
+	Translator
+	TranslateStream(ctx context.Context, turns []Turn, text, fromLang, toLang string, onDelta func(partial string)) (string, error)
+}
+
+// translateStream streams from t if it supports streaming and translates
+// normally otherwise
+func translateStream(ctx context.Context, t Translator, turns []Turn, text, fromLang, toLang string, onDelta func(string)) (string, error) {
+	if st, ok := t.(StreamingTranslator); ok {
+		return st.TranslateStream(ctx, turns, text, fromLang, toLang, onDelta)
+	}
+	if ct, ok := t.(ConversationTranslator); ok && len(turns) > 0 {
+		return ct.TranslateConversation(ctx, turns, text, fromLang, toLang)
+	}
+	return t.Translate(ctx, text, fromLang, toLang)
+}
+
+// TranslateStream translates text using OpenAI's streaming API, using turns as
+// conversation context when given
+func (t *OpenAITranslator) TranslateStream(ctx context.Context, turns []Turn, text, fromLang, toLang string, onDelta func(partial string)) (string, error) {
+	if fromLang == toLang {
+		return text, nil
+	}
+
+	data := promptData(ctx, text, fromLang, toLang)
+	var messages []openai.ChatCompletionMessage
+	if len(turns) > 0 {
+		data.Conversation = true
+		var err error
+		messages, err = conversationMessages(t.config.Prompt, trimTurns(turns, t.config.ContextTokenBudget), data)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		system, user, err := t.config.Prompt.render(data)
+		if err != nil {
+			return "", err
+		}
+		messages = []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: system},
+			{Role: openai.ChatMessageRoleUser, Content: user},
+		}
+	}
+
+	translated, err := t.stream(ctx, messages, func(partial string) {
+		if onDelta != nil {
+			if cleaned := sanitizeOutput(partial, text); cleaned != "" {
+				onDelta(cleaned)
+			}
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	return sanitizeOutput(translated, text), nil
+}
+
+// stream sends a streaming chat completion request, reporting the reply so
+// far as it arrives, and returns the complete reply
+func (t *OpenAITranslator) stream(ctx context.Context, messages []openai.ChatCompletionMessage, onDelta func(string)) (string, error) {
+	var retryAfter time.Duration
+	ctx = context.WithValue(ctx, retryAfterKey{}, &retryAfter)
+
+	req := openai.ChatCompletionRequest{
+		Model:       t.config.Model,
+		Messages:    messages,
+		MaxTokens:   t.config.MaxTokens,
+		Temperature: t.temperature(),
+		Stream:      true,
+	}
+	if t.config.Usage != nil {
+		// Usage arrives in a final chunk without choices
+		req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+	stream, err := t.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return "", openAIError(err, retryAfter)
+	}
+	defer stream.Close()
+
+	var reply strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", openAIError(err, retryAfter)
+		}
+		if chunk.Usage != nil {
+			t.recordUsage(ctx, chunk.Model, *chunk.Usage)
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		reply.WriteString(chunk.Choices[0].Delta.Content)
+		onDelta(reply.String())
+	}
+
+	if reply.Len() == 0 {
+		return "", errors.New("no translation received from OpenAI")
+	}
+	return reply.String(), nil
+}
@@ -2,53 +2,170 @@ package translate
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
+	"shabe/server/glossary"
+	"shabe/server/usage"
 )
 
-// Translator defines the interface for translation services
+// Translator defines the interface for translation services. Implementations
+// must give up and return ctx.Err() once ctx is done.
 type Translator interface {
-	Translate(text, fromLang, toLang string) (string, error)
+	Translate(ctx context.Context, text, fromLang, toLang string) (string, error)
+}
+
+// DefaultOpenAIModel is the model used when OpenAIConfig.Model is empty
+const DefaultOpenAIModel = openai.GPT4oMini20240718
+
+// OpenAIConfig holds the OpenAITranslator configuration
+type OpenAIConfig struct {
+	// APIKey may be empty for self-hosted servers that do not check it
+	APIKey string
+	// BaseURL points the translator at any OpenAI-compatible server such
+	// as vLLM, Ollama or LocalAI, e.g. http://localhost:11434/v1. Empty
+	// uses the public OpenAI API.
+	BaseURL string
+	// Model is the chat model to use; empty means DefaultOpenAIModel
+	Model string
+	// Temperature defaults to zero so translations are repeatable
+	Temperature float32
+	// MaxTokens bounds the length of each translation; zero means 1000
+	MaxTokens int
+	// Prompt holds the prompt templates; nil means DefaultPrompt()
+	Prompt     *Prompt
+	HTTPClient *http.Client
+	// ContextTokenBudget bounds the estimated tokens of conversation context
+	// sent with each context-aware translation
+	ContextTokenBudget int
+	// Usage receives the token usage of every response; nil disables usage
+	// accounting
+	Usage usage.Recorder
 }
 
 // OpenAITranslator implements the Translator interface using OpenAI's API
 type OpenAITranslator struct {
 	client *openai.Client
+	config OpenAIConfig
 }
 
 // NewOpenAITranslator creates a new OpenAITranslator
 func NewOpenAITranslator(apiKey string) *OpenAITranslator {
+	return NewOpenAITranslatorWithConfig(OpenAIConfig{
+		APIKey:             apiKey,
+		ContextTokenBudget: 1000,
+	})
+}
+
+// NewOpenAITranslatorWithConfig creates a new OpenAITranslator
+func NewOpenAITranslatorWithConfig(cfg OpenAIConfig) *OpenAITranslator {
+	if cfg.Model == "" {
+		cfg.Model = DefaultOpenAIModel
+	}
+	if cfg.MaxTokens <= 0 {
+		cfg.MaxTokens = 1000
+	}
+	if cfg.Prompt == nil {
+		cfg.Prompt = DefaultPrompt()
+	}
+
+	clientConfig := openai.DefaultConfig(cfg.APIKey)
+	if cfg.BaseURL != "" {
+		clientConfig.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	}
+	if cfg.HTTPClient != nil {
+		clientConfig.HTTPClient = cfg.HTTPClient
+	}
+	clientConfig.HTTPClient = retryAfterRecorder{doer: clientConfig.HTTPClient}
+
 	return &OpenAITranslator{
-		client: openai.NewClient(apiKey),
+		client: openai.NewClientWithConfig(clientConfig),
+		config: cfg,
 	}
 }
 
 // Translate translates text from one language to another using OpenAI's API
-func (t *OpenAITranslator) Translate(text, fromLang, toLang string) (string, error) {
+func (t *OpenAITranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
 	if fromLang == toLang {
 		return text, nil
 	}
 
-	prompt := fmt.Sprintf("Translate the following text from %s to %s:\n\n%s", fromLang, toLang, text)
-	resp, err := t.client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: openai.GPT4oMini20240718,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
-			},
-			MaxTokens:   1000,
-			Temperature: 0.7,
-		},
-	)
+	system, user, err := t.config.Prompt.render(promptData(ctx, text, fromLang, toLang))
+	if err != nil {
+		return "", err
+	}
+	translated, err := t.complete(ctx, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: system},
+		{Role: openai.ChatMessageRoleUser, Content: user},
+	})
+	if err != nil {
+		return "", err
+	}
+	return sanitizeOutput(translated, text), nil
+}
 
+// TranslateConversation translates text using recent conversation turns as
+// context, keeping as many of the latest turns as fit in the token budget
+func (t *OpenAITranslator) TranslateConversation(ctx context.Context, turns []Turn, text, fromLang, toLang string) (string, error) {
+	if fromLang == toLang {
+		return text, nil
+	}
+
+	turns = trimTurns(turns, t.config.ContextTokenBudget)
+	data := promptData(ctx, text, fromLang, toLang)
+	data.Conversation = true
+	messages, err := conversationMessages(t.config.Prompt, turns, data)
+	if err != nil {
+		return "", err
+	}
+	translated, err := t.complete(ctx, messages)
 	if err != nil {
-		return "", fmt.Errorf("error calling OpenAI API: %v", err)
+		return "", err
 	}
+	return sanitizeOutput(translated, text), nil
+}
+
+// promptData returns the prompt template data for a translation, including
+// the glossary carried by ctx
+func promptData(ctx context.Context, text, fromLang, toLang string) PromptData {
+	g := glossary.FromContext(ctx).For(fromLang, toLang)
+	return PromptData{
+		From:           fromLang,
+		To:             toLang,
+		Text:           text,
+		Formality:      FormalityFromContext(ctx),
+		Glossary:       g.Terms,
+		DoNotTranslate: g.DoNotTranslate,
+	}
+}
+
+// complete sends a chat completion request and returns the first choice
+func (t *OpenAITranslator) complete(ctx context.Context, messages []openai.ChatCompletionMessage) (string, error) {
+	return t.completeRequest(ctx, openai.ChatCompletionRequest{
+		Messages:  messages,
+		MaxTokens: t.config.MaxTokens,
+	})
+}
+
+// completeRequest sends req with the configured model and temperature and
+// returns the first choice
+func (t *OpenAITranslator) completeRequest(ctx context.Context, req openai.ChatCompletionRequest) (string, error) {
+	var retryAfter time.Duration
+	ctx = context.WithValue(ctx, retryAfterKey{}, &retryAfter)
+
+	req.Model = t.config.Model
+	req.Temperature = t.temperature()
+	resp, err := t.client.CreateChatCompletion(ctx, req)
+
+	if err != nil {
+		return "", openAIError(err, retryAfter)
+	}
+	t.recordUsage(ctx, resp.Model, resp.Usage)
 
 	if len(resp.Choices) == 0 {
 		return "", fmt.Errorf("no translation received from OpenAI")
@@ -57,6 +174,62 @@ func (t *OpenAITranslator) Translate(text, fromLang, toLang string) (string, err
 	return resp.Choices[0].Message.Content, nil
 }
 
+// recordUsage reports the tokens a response used, if usage is being recorded
+func (t *OpenAITranslator) recordUsage(ctx context.Context, model string, u openai.Usage) {
+	if t.config.Usage == nil {
+		return
+	}
+	if model == "" {
+		model = t.config.Model
+	}
+	t.config.Usage.Record(ctx, model, u.PromptTokens, u.CompletionTokens)
+}
+
+// temperature returns the sampling temperature to send. The client omits a
+// zero temperature, which servers treat as their default of 1.
+func (t *OpenAITranslator) temperature() float32 {
+	if t.config.Temperature == 0 {
+		return math.SmallestNonzeroFloat32
+	}
+	return t.config.Temperature
+}
+
+// openAIError wraps an error from the OpenAI client in a ProviderError
+func openAIError(err error, retryAfter time.Duration) error {
+	providerErr := &ProviderError{Provider: "OpenAI", RetryAfter: retryAfter, Err: err}
+
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		providerErr.StatusCode = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		providerErr.StatusCode = reqErr.HTTPStatusCode
+	}
+	return providerErr
+}
+
+// retryAfterKey is the context key under which complete stores where the
+// Retry-After delay of a failed response should be recorded
+type retryAfterKey struct{}
+
+// retryAfterRecorder records the Retry-After header of failed responses,
+// which the OpenAI client does not expose in its errors
+type retryAfterRecorder struct {
+	doer openai.HTTPDoer
+}
+
+// Do sends the request and records any Retry-After header on failure
+func (r retryAfterRecorder) Do(req *http.Request) (*http.Response, error) {
+	resp, err := r.doer.Do(req)
+	if err == nil && resp.StatusCode >= 400 {
+		if retryAfter, ok := req.Context().Value(retryAfterKey{}).(*time.Duration); ok {
+			*retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		}
+	}
+	return resp, err
+}
+
 // MockTranslator implements the Translator interface for testing
 type MockTranslator struct {
 	translations map[string]string
@@ -75,7 +248,10 @@ func NewMockTranslator() *MockTranslator {
 }
 
 // Translate returns predefined translations for testing
-func (t *MockTranslator) Translate(text, fromLang, toLang string) (string, error) {
+func (t *MockTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	if fromLang == toLang {
 		return text, nil
 	}
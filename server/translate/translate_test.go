@@ -0,0 +1,993 @@
+package translate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"shabe/server/glossary"
+	"shabe/server/usage"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 0, EstimateTokens(""))
+	assert.Equal(t, 3, EstimateTokens("hello there!"))
+	assert.Equal(t, 5, EstimateTokens("こんにちは"))
+}
+
+func TestTrimTurns(t *testing.T) {
+	turns := []Turn{
+		{Speaker: "A", Text: "first message here"},
+		{Speaker: "B", Text: "second message here"},
+		{Speaker: "C", Text: "third message here"},
+	}
+
+	// Each turn costs 1 (speaker) + 5 (text) tokens; only the newest two fit
+	trimmed := trimTurns(turns, 12)
+	assert.Equal(t, turns[1:], trimmed)
+
+	assert.Empty(t, trimTurns(turns, 0))
+	assert.Equal(t, turns, trimTurns(turns, 100))
+}
+
+func TestConversationMessages(t *testing.T) {
+	turns := []Turn{
+		{Speaker: "Alice", Language: "en", Text: "I met Bob yesterday", Translation: "昨日ボブに会いました"},
+		{Speaker: "Taro", Language: "ja", Text: "彼は元気でしたか？"},
+	}
+
+	messages, err := conversationMessages(DefaultPrompt(), turns, PromptData{From: "en", To: "ja", Text: "He was fine", Conversation: true})
+	assert.NoError(t, err)
+	assert.Len(t, messages, 5)
+	assert.Equal(t, openai.ChatMessageRoleSystem, messages[0].Role)
+	assert.Contains(t, messages[0].Content, "from English to Japanese")
+
+	// Earlier translations become user/assistant pairs
+	assert.Equal(t, openai.ChatMessageRoleUser, messages[1].Role)
+	assert.Equal(t, "I met Bob yesterday", messages[1].Content)
+	assert.Equal(t, openai.ChatMessageRoleAssistant, messages[2].Role)
+	assert.Equal(t, "昨日ボブに会いました", messages[2].Content)
+
+	// Turns already in the target language are given as notes
+	assert.Equal(t, openai.ChatMessageRoleSystem, messages[3].Role)
+	assert.Equal(t, "Taro said (ja): 彼は元気でしたか？", messages[3].Content)
+
+	assert.Equal(t, openai.ChatMessageRoleUser, messages[4].Role)
+	assert.Equal(t, "He was fine", messages[4].Content)
+
+	// Custom prompts see each earlier turn's own source language
+	prompt, err := ParsePrompt("", "{{.From}} {{.FromName}}: {{.Text}}")
+	assert.NoError(t, err)
+	turns[0].Language = "de"
+	messages, err = conversationMessages(prompt, turns, PromptData{From: "en", To: "ja", Text: "He was fine", Conversation: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "de German: I met Bob yesterday", messages[1].Content)
+	assert.Equal(t, "en English: He was fine", messages[4].Content)
+}
+
+// countingTranslator counts calls to the underlying translator
+type countingTranslator struct {
+	calls int
+	err   error
+}
+
+func (t *countingTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	t.calls++
+	if t.err != nil {
+		return "", t.err
+	}
+	return "[" + toLang + "] " + text, nil
+}
+
+func TestCachingTranslator(t *testing.T) {
+	next := &countingTranslator{}
+	cache, err := NewCachingTranslator(next, CacheOptions{Size: 2})
+	assert.NoError(t, err)
+
+	// Whitespace differences share a cache entry
+	first, err := cache.Translate(context.Background(), "hello  world", "en", "ja")
+	assert.NoError(t, err)
+	second, err := cache.Translate(context.Background(), " hello world ", "en", "ja")
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, next.calls)
+
+	// The language pair is part of the key
+	cache.Translate(context.Background(), "hello world", "en", "es")
+	assert.Equal(t, 2, next.calls)
+
+	// Adding a third entry evicts the least recently used one
+	cache.Translate(context.Background(), "hello world", "en", "ja")
+	cache.Translate(context.Background(), "goodbye", "en", "ja")
+	cache.Translate(context.Background(), "hello world", "en", "ja")
+	assert.Equal(t, 3, next.calls)
+	cache.Translate(context.Background(), "hello world", "en", "es")
+	assert.Equal(t, 4, next.calls)
+
+	assert.Equal(t, CacheStats{Hits: 3, Misses: 4, Size: 2}, cache.Stats())
+
+	// Errors are not cached
+	next.err = errors.New("unavailable")
+	_, err = cache.Translate(context.Background(), "new text", "en", "ja")
+	assert.Error(t, err)
+	next.err = nil
+	_, err = cache.Translate(context.Background(), "new text", "en", "ja")
+	assert.NoError(t, err)
+}
+
+func TestCachingTranslator_TTL(t *testing.T) {
+	next := &countingTranslator{}
+	cache, err := NewCachingTranslator(next, CacheOptions{Size: 10, TTL: 20 * time.Millisecond})
+	assert.NoError(t, err)
+
+	cache.Translate(context.Background(), "hello", "en", "ja")
+	cache.Translate(context.Background(), "hello", "en", "ja")
+	assert.Equal(t, 1, next.calls)
+
+	time.Sleep(30 * time.Millisecond)
+	cache.Translate(context.Background(), "hello", "en", "ja")
+	assert.Equal(t, 2, next.calls)
+}
+
+func TestCachingTranslator_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	next := &countingTranslator{}
+	cache, err := NewCachingTranslator(next, CacheOptions{Size: 10, PersistPath: path})
+	assert.NoError(t, err)
+	cache.Translate(context.Background(), "hello", "en", "ja")
+	assert.NoError(t, cache.Close())
+
+	// A new cache loaded from the same file is already warm
+	next = &countingTranslator{}
+	cache, err = NewCachingTranslator(next, CacheOptions{Size: 10, PersistPath: path})
+	assert.NoError(t, err)
+	translated, err := cache.Translate(context.Background(), "hello", "en", "ja")
+	assert.NoError(t, err)
+	assert.Equal(t, "[ja] hello", translated)
+	assert.Equal(t, 0, next.calls)
+
+	// Translations made with another provider, model or prompt are dropped
+	assert.NoError(t, cache.Close())
+	cache, err = NewCachingTranslator(next, CacheOptions{Size: 10, PersistPath: path, Fingerprint: "other-model"})
+	assert.NoError(t, err)
+	assert.Zero(t, cache.Stats().Size)
+	cache.Translate(context.Background(), "hello", "en", "ja")
+	assert.Equal(t, 1, next.calls)
+	assert.NoError(t, cache.Close())
+
+	cache, err = NewCachingTranslator(next, CacheOptions{Size: 10, PersistPath: path, Fingerprint: "other-model"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cache.Stats().Size)
+}
+
+// legacyMock implements the pre-context translator signature
+type legacyMock struct {
+	delay time.Duration
+}
+
+func (m legacyMock) Translate(text, fromLang, toLang string) (string, error) {
+	time.Sleep(m.delay)
+	return "[" + toLang + "] " + text, nil
+}
+
+func TestLegacyAdapters(t *testing.T) {
+	translated, err := FromLegacy(legacyMock{}).Translate(context.Background(), "hello", "en", "ja")
+	assert.NoError(t, err)
+	assert.Equal(t, "[ja] hello", translated)
+
+	// A slow legacy translator is abandoned when the context expires
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = FromLegacy(legacyMock{delay: time.Second}).Translate(ctx, "hello", "en", "ja")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Callers of the old signature get a per-call deadline
+	legacy := ToLegacy(FromLegacy(legacyMock{delay: time.Second}), 10*time.Millisecond)
+	_, err = legacy.Translate("hello", "en", "ja")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	translated, err = ToLegacy(NewMockTranslator(), time.Second).Translate("hello", "en", "ja")
+	assert.NoError(t, err)
+	assert.Equal(t, "こんにちは", translated)
+}
+
+// flakyTranslator fails with the queued errors before succeeding
+type flakyTranslator struct {
+	mu    sync.Mutex
+	errs  []error
+	calls int
+}
+
+func (t *flakyTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.calls++
+	if len(t.errs) > 0 {
+		err := t.errs[0]
+		t.errs = t.errs[1:]
+		return "", err
+	}
+	return "[" + toLang + "] " + text, nil
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, IsTransient(&ProviderError{Provider: "OpenAI", StatusCode: 429}))
+	assert.True(t, IsTransient(&ProviderError{Provider: "OpenAI", StatusCode: 503}))
+	assert.False(t, IsTransient(&ProviderError{Provider: "OpenAI", StatusCode: 400}))
+	assert.True(t, IsTransient(context.DeadlineExceeded))
+	assert.False(t, IsTransient(context.Canceled))
+	assert.False(t, IsTransient(errors.New("boom")))
+
+	assert.Equal(t, 2*time.Second, parseRetryAfter("2"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+}
+
+func TestResilientTranslator_Retries(t *testing.T) {
+	opts := ResilienceOptions{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+	t.Run("transient failures are retried", func(t *testing.T) {
+		next := &flakyTranslator{errs: []error{
+			&ProviderError{Provider: "OpenAI", StatusCode: 429},
+			&ProviderError{Provider: "OpenAI", StatusCode: 502},
+		}}
+		translated, err := NewResilientTranslator(next, opts).Translate(context.Background(), "hi", "en", "ja")
+		assert.NoError(t, err)
+		assert.Equal(t, "[ja] hi", translated)
+		assert.Equal(t, 3, next.calls)
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		next := &flakyTranslator{errs: []error{
+			&ProviderError{Provider: "OpenAI", StatusCode: 500},
+			&ProviderError{Provider: "OpenAI", StatusCode: 500},
+			&ProviderError{Provider: "OpenAI", StatusCode: 500},
+		}}
+		_, err := NewResilientTranslator(next, opts).Translate(context.Background(), "hi", "en", "ja")
+		assert.Error(t, err)
+		assert.Equal(t, 3, next.calls)
+	})
+
+	t.Run("permanent failures are not retried", func(t *testing.T) {
+		next := &flakyTranslator{errs: []error{&ProviderError{Provider: "OpenAI", StatusCode: 401}}}
+		_, err := NewResilientTranslator(next, opts).Translate(context.Background(), "hi", "en", "ja")
+		assert.Error(t, err)
+		assert.Equal(t, 1, next.calls)
+	})
+
+	t.Run("retry-after is honoured", func(t *testing.T) {
+		next := &flakyTranslator{errs: []error{
+			&ProviderError{Provider: "OpenAI", StatusCode: 429, RetryAfter: 50 * time.Millisecond},
+		}}
+		start := time.Now()
+		_, err := NewResilientTranslator(next, opts).Translate(context.Background(), "hi", "en", "ja")
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("no retry past the deadline", func(t *testing.T) {
+		next := &flakyTranslator{errs: []error{
+			&ProviderError{Provider: "OpenAI", StatusCode: 429, RetryAfter: time.Minute},
+		}}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err := NewResilientTranslator(next, opts).Translate(ctx, "hi", "en", "ja")
+		assert.Error(t, err)
+		assert.Equal(t, 1, next.calls)
+	})
+}
+
+func TestResilientTranslator_CircuitBreaker(t *testing.T) {
+	unavailable := &ProviderError{Provider: "OpenAI", StatusCode: 503}
+	next := &flakyTranslator{errs: []error{unavailable, unavailable}}
+	r := NewResilientTranslator(next, ResilienceOptions{
+		FailureThreshold: 2,
+		OpenDuration:     50 * time.Millisecond,
+	})
+
+	var states []bool
+	r.OnStateChange(func(degraded bool) { states = append(states, degraded) })
+
+	for i := 0; i < 2; i++ {
+		_, err := r.Translate(context.Background(), "hi", "en", "ja")
+		assert.Error(t, err)
+	}
+	assert.True(t, r.Degraded())
+
+	// Calls fail fast while the circuit is open
+	_, err := r.Translate(context.Background(), "hi", "en", "ja")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 2, next.calls)
+
+	// A successful trial call after the open period closes it again
+	time.Sleep(60 * time.Millisecond)
+	translated, err := r.Translate(context.Background(), "hi", "en", "ja")
+	assert.NoError(t, err)
+	assert.Equal(t, "[ja] hi", translated)
+	assert.False(t, r.Degraded())
+	assert.Equal(t, []bool{true, false}, states)
+}
+
+func TestResilientTranslator_CircuitBreakerWithRetries(t *testing.T) {
+	unavailable := &ProviderError{Provider: "OpenAI", StatusCode: 503}
+	next := &flakyTranslator{errs: []error{unavailable, unavailable, unavailable}}
+	r := NewResilientTranslator(next, ResilienceOptions{
+		MaxRetries:       2,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         time.Millisecond,
+		FailureThreshold: 2,
+		OpenDuration:     time.Minute,
+	})
+
+	// A call that fails on every attempt is a single failure, however
+	// often it was retried
+	_, err := r.Translate(context.Background(), "hi", "en", "ja")
+	assert.Error(t, err)
+	assert.Equal(t, 3, next.calls)
+	assert.False(t, r.Degraded())
+
+	// A call that recovers on a retry resets the count
+	next.errs = []error{unavailable}
+	_, err = r.Translate(context.Background(), "hi", "en", "ja")
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		next.errs = []error{unavailable, unavailable, unavailable}
+		_, err = r.Translate(context.Background(), "hi", "en", "ja")
+		assert.Error(t, err)
+	}
+	assert.True(t, r.Degraded())
+}
+
+// providerServer starts a stand-in for a provider's HTTP API that checks each
+// request and answers with the given status and body
+func providerServer(t *testing.T, check func(r *http.Request, body []byte), status int, response string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		check(r, body)
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "3")
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDeepLTranslator(t *testing.T) {
+	server := providerServer(t, func(r *http.Request, body []byte) {
+		assert.Equal(t, "/v2/translate", r.URL.Path)
+		assert.Equal(t, "DeepL-Auth-Key secret", r.Header.Get("Authorization"))
+		assert.JSONEq(t, `{"text":["hello"],"source_lang":"EN","target_lang":"PT-BR"}`, string(body))
+	}, http.StatusOK, `{"translations":[{"detected_source_language":"EN","text":"olá"}]}`)
+
+	translator := NewDeepLTranslator(DeepLConfig{APIKey: "secret", BaseURL: server.URL})
+	translated, err := translator.Translate(context.Background(), "hello", "en", "pt")
+	assert.NoError(t, err)
+	assert.Equal(t, "olá", translated)
+
+	// Only variants DeepL supports are kept
+	for tag, want := range map[string]string{
+		"ja": "JA", "ja-JP": "JA", "de-AT": "DE", "es-MX": "ES", "en": "EN-US", "en-GB": "EN-GB",
+		"en-AU": "EN-US", "pt": "PT-BR", "pt-PT": "PT-PT", "zh": "ZH", "zh-Hant": "ZH-HANT", "zh-Hans-CN": "ZH-HANS",
+	} {
+		assert.Equal(t, want, deepLTargetLang(tag), tag)
+	}
+
+	assert.Equal(t, deepLFreeURL, NewDeepLTranslator(DeepLConfig{APIKey: "key:fx"}).config.BaseURL)
+	assert.Equal(t, deepLProURL, NewDeepLTranslator(DeepLConfig{APIKey: "key"}).config.BaseURL)
+}
+
+func TestGoogleTranslator(t *testing.T) {
+	server := providerServer(t, func(r *http.Request, body []byte) {
+		assert.Equal(t, "/language/translate/v2", r.URL.Path)
+		assert.Equal(t, "secret", r.Header.Get("X-Goog-Api-Key"))
+		assert.Empty(t, r.URL.RawQuery)
+		assert.JSONEq(t, `{"q":["hello"],"source":"en","target":"ja","format":"text"}`, string(body))
+	}, http.StatusOK, `{"data":{"translations":[{"translatedText":"こんにちは"}]}}`)
+
+	translator := NewGoogleTranslator(GoogleConfig{APIKey: "secret", BaseURL: server.URL})
+	translated, err := translator.Translate(context.Background(), "hello", "en", "ja")
+	assert.NoError(t, err)
+	assert.Equal(t, "こんにちは", translated)
+}
+
+func TestLibreTranslateTranslator(t *testing.T) {
+	server := providerServer(t, func(r *http.Request, body []byte) {
+		assert.Equal(t, "/translate", r.URL.Path)
+		assert.JSONEq(t, `{"q":"hello","source":"auto","target":"es","format":"text","api_key":"secret"}`, string(body))
+	}, http.StatusOK, `{"translatedText":"hola"}`)
+
+	translator := NewLibreTranslateTranslator(LibreTranslateConfig{URL: server.URL + "/", APIKey: "secret"})
+	translated, err := translator.Translate(context.Background(), "hello", "", "es")
+	assert.NoError(t, err)
+	assert.Equal(t, "hola", translated)
+}
+
+func TestAzureTranslator(t *testing.T) {
+	server := providerServer(t, func(r *http.Request, body []byte) {
+		assert.Equal(t, "/translate", r.URL.Path)
+		assert.Equal(t, "3.0", r.URL.Query().Get("api-version"))
+		assert.Equal(t, "en", r.URL.Query().Get("from"))
+		assert.Equal(t, "de", r.URL.Query().Get("to"))
+		assert.Equal(t, "secret", r.Header.Get("Ocp-Apim-Subscription-Key"))
+		assert.Equal(t, "westeurope", r.Header.Get("Ocp-Apim-Subscription-Region"))
+		assert.JSONEq(t, `[{"Text":"hello"}]`, string(body))
+	}, http.StatusOK, `[{"translations":[{"text":"hallo","to":"de"}]}]`)
+
+	translator := NewAzureTranslator(AzureConfig{Key: "secret", Region: "westeurope", Endpoint: server.URL})
+	translated, err := translator.Translate(context.Background(), "hello", "en", "de")
+	assert.NoError(t, err)
+	assert.Equal(t, "hallo", translated)
+}
+
+func TestProviderErrors(t *testing.T) {
+	ignore := func(r *http.Request, body []byte) {}
+
+	server := providerServer(t, ignore, http.StatusTooManyRequests, `{"message":"slow down"}`)
+	_, err := NewDeepLTranslator(DeepLConfig{BaseURL: server.URL}).Translate(context.Background(), "hello", "en", "ja")
+	var providerErr *ProviderError
+	assert.ErrorAs(t, err, &providerErr)
+	assert.Equal(t, "DeepL", providerErr.Provider)
+	assert.Equal(t, http.StatusTooManyRequests, providerErr.StatusCode)
+	assert.Equal(t, 3*time.Second, providerErr.RetryAfter)
+	assert.Contains(t, err.Error(), "slow down")
+	assert.True(t, IsTransient(err))
+
+	server = providerServer(t, ignore, http.StatusForbidden, `{"error":"invalid key"}`)
+	_, err = NewLibreTranslateTranslator(LibreTranslateConfig{URL: server.URL}).Translate(context.Background(), "hello", "en", "ja")
+	assert.ErrorAs(t, err, &providerErr)
+	assert.Equal(t, http.StatusForbidden, providerErr.StatusCode)
+	assert.False(t, IsTransient(err))
+
+	server = providerServer(t, ignore, http.StatusOK, `[]`)
+	_, err = NewAzureTranslator(AzureConfig{Endpoint: server.URL}).Translate(context.Background(), "hello", "en", "ja")
+	assert.Error(t, err)
+}
+
+// hangingTranslator never answers before its context is done
+type hangingTranslator struct{}
+
+func (hangingTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestFallbackTranslator(t *testing.T) {
+	t.Run("falls back on error", func(t *testing.T) {
+		failing := &countingTranslator{err: errors.New("boom")}
+		backup := &countingTranslator{}
+		f := NewFallbackTranslator(0, Provider{Name: "first", Translator: failing}, Provider{Name: "second", Translator: backup})
+
+		translated, err := f.Translate(context.Background(), "hello", "en", "ja")
+		assert.NoError(t, err)
+		assert.Equal(t, "[ja] hello", translated)
+		assert.Equal(t, 1, failing.calls)
+		assert.Equal(t, 1, backup.calls)
+	})
+
+	t.Run("falls back on timeout", func(t *testing.T) {
+		f := NewFallbackTranslator(20*time.Millisecond, Provider{Name: "slow", Translator: hangingTranslator{}}, Provider{Name: "fast", Translator: &countingTranslator{}})
+
+		translated, err := f.Translate(context.Background(), "hello", "en", "ja")
+		assert.NoError(t, err)
+		assert.Equal(t, "[ja] hello", translated)
+	})
+
+	t.Run("returns the last error when all fail", func(t *testing.T) {
+		f := NewFallbackTranslator(0,
+			Provider{Name: "first", Translator: &countingTranslator{err: errors.New("boom")}},
+			Provider{Name: "second", Translator: &countingTranslator{err: &ProviderError{Provider: "second", StatusCode: 503}}},
+		)
+		_, err := f.Translate(context.Background(), "hello", "en", "ja")
+		assert.True(t, IsTransient(err))
+	})
+
+	t.Run("stops when the caller gives up", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		backup := &countingTranslator{}
+		f := NewFallbackTranslator(0, Provider{Name: "only", Translator: backup})
+		_, err := f.Translate(ctx, "hello", "en", "ja")
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 0, backup.calls)
+	})
+}
+
+func TestOpenAITranslator_CompatibleServer(t *testing.T) {
+	server := providerServer(t, func(r *http.Request, body []byte) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		var req openai.ChatCompletionRequest
+		assert.NoError(t, json.Unmarshal(body, &req))
+		assert.Equal(t, "llama3.1", req.Model)
+	}, http.StatusOK, `{"choices":[{"index":0,"message":{"role":"assistant","content":"hola"}}]}`)
+
+	translator := NewOpenAITranslatorWithConfig(OpenAIConfig{BaseURL: server.URL + "/v1/", Model: "llama3.1"})
+	translated, err := translator.Translate(context.Background(), "hello", "en", "es")
+	assert.NoError(t, err)
+	assert.Equal(t, "hola", translated)
+
+	assert.Equal(t, DefaultOpenAIModel, NewOpenAITranslator("key").config.Model)
+}
+
+func TestOpenAITranslator_RateLimited(t *testing.T) {
+	server := providerServer(t, func(r *http.Request, body []byte) {}, http.StatusTooManyRequests,
+		`{"error":{"message":"rate limited","type":"requests"}}`)
+
+	translator := NewOpenAITranslatorWithConfig(OpenAIConfig{BaseURL: server.URL})
+	_, err := translator.Translate(context.Background(), "hello", "en", "es")
+	var providerErr *ProviderError
+	assert.ErrorAs(t, err, &providerErr)
+	assert.Equal(t, http.StatusTooManyRequests, providerErr.StatusCode)
+	assert.Equal(t, 3*time.Second, providerErr.RetryAfter)
+}
+
+func TestParsePrompt(t *testing.T) {
+	system, user, err := DefaultPrompt().render(PromptData{From: "en", To: "ja", Text: "hello"})
+	assert.NoError(t, err)
+	assert.Contains(t, system, "from English to Japanese")
+	assert.NotContains(t, system, "earlier turns")
+	assert.Equal(t, "hello", user)
+
+	prompt, err := ParsePrompt("Translate {{.From}} into {{.To}}.", "<text>{{.Text}}</text>")
+	assert.NoError(t, err)
+	system, user, err = prompt.render(PromptData{From: "en", To: "ja", Text: "hello"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Translate en into ja.", system)
+	assert.Equal(t, "<text>hello</text>", user)
+
+	_, err = ParsePrompt("{{.From", "")
+	assert.Error(t, err)
+	_, err = ParsePrompt("{{.Unknown}}", "")
+	assert.Error(t, err)
+}
+
+func TestSanitizeOutput(t *testing.T) {
+	tests := []struct {
+		output string
+		source string
+		want   string
+	}{
+		{"こんにちは", "hello", "こんにちは"},
+		{"Here is the translation:\nこんにちは", "hello", "こんにちは"},
+		{"Sure! Here's the translation in Japanese: こんにちは", "hello", "こんにちは"},
+		{"Translation: hola", "hello", "hola"},
+		{`"hola"`, "hello", "hola"},
+		{"「こんにちは」", "hello", "こんにちは"},
+		{`"hola"`, `"hello"`, `"hola"`},
+		{`"hola" y "adiós"`, "hello and goodbye", `"hola" y "adiós"`},
+		{"hola\n\nNote: this is informal.", "hello", "hola"},
+		{"Translation:", "Translation:", "Translation:"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, sanitizeOutput(tt.output, tt.source), tt.output)
+	}
+}
+
+func TestOpenAITranslator_Request(t *testing.T) {
+	var req openai.ChatCompletionRequest
+	server := providerServer(t, func(r *http.Request, body []byte) {
+		assert.NoError(t, json.Unmarshal(body, &req))
+	}, http.StatusOK, `{"choices":[{"index":0,"message":{"role":"assistant","content":"Here is the translation: \"hola\""}}]}`)
+
+	prompt, err := ParsePrompt("From {{.From}} to {{.To}}", "")
+	assert.NoError(t, err)
+	translator := NewOpenAITranslatorWithConfig(OpenAIConfig{BaseURL: server.URL, MaxTokens: 200, Prompt: prompt})
+	translated, err := translator.Translate(context.Background(), "hello", "en", "es")
+	assert.NoError(t, err)
+	assert.Equal(t, "hola", translated)
+
+	assert.Equal(t, 200, req.MaxTokens)
+	assert.Greater(t, req.Temperature, float32(0))
+	assert.Less(t, req.Temperature, float32(0.001))
+	assert.Equal(t, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "From en to es"},
+		{Role: openai.ChatMessageRoleUser, Content: "hello"},
+	}, req.Messages)
+}
+
+// recordingTranslator records the text it is asked to translate and returns
+// a canned reply
+type recordingTranslator struct {
+	text  string
+	reply string
+}
+
+func (t *recordingTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	t.text = text
+	return t.reply, nil
+}
+
+func TestMaskingTranslator(t *testing.T) {
+	g := glossary.Glossary{
+		Terms: []glossary.Term{
+			{Source: "Shabe", Target: "シャベ", ToLang: "ja"},
+			{Source: "stand-up", Target: "朝会"},
+		},
+		DoNotTranslate: []string{"Kubernetes", "Kube"},
+	}
+	ctx := glossary.NewContext(context.Background(), g)
+
+	next := &recordingTranslator{reply: "⟦0⟧の⟦ 1 ⟧で⟦2⟧について話しました"}
+	translated, err := NewMaskingTranslator(next).Translate(ctx, "We discussed shabe's Kubernetes setup at the stand-up", "en", "ja")
+	assert.NoError(t, err)
+	assert.Equal(t, "We discussed ⟦0⟧'s ⟦1⟧ setup at the ⟦2⟧", next.text)
+	assert.Equal(t, "シャベのKubernetesで朝会について話しました", translated)
+
+	// Terms only match whole words
+	next = &recordingTranslator{reply: "ok"}
+	NewMaskingTranslator(next).Translate(ctx, "Kubeflow", "en", "ja")
+	assert.Equal(t, "Kubeflow", next.text)
+
+	// Terms for other language pairs are left alone
+	next = &recordingTranslator{reply: "ok"}
+	NewMaskingTranslator(next).Translate(ctx, "Shabe", "en", "es")
+	assert.Equal(t, "Shabe", next.text)
+}
+
+func TestPrompt_Glossary(t *testing.T) {
+	ctx := glossary.NewContext(context.Background(), glossary.Glossary{
+		Terms:          []glossary.Term{{Source: "Shabe", Target: "シャベ"}},
+		DoNotTranslate: []string{"Kubernetes", "Alice"},
+	})
+	system, _, err := DefaultPrompt().render(promptData(ctx, "hello", "en", "ja"))
+	assert.NoError(t, err)
+	assert.Contains(t, system, "- Shabe → シャベ")
+	assert.Contains(t, system, "Kubernetes, Alice")
+}
+
+func TestCachingTranslator_Glossary(t *testing.T) {
+	next := &countingTranslator{}
+	cache, err := NewCachingTranslator(next, CacheOptions{Size: 10})
+	assert.NoError(t, err)
+
+	ctx := glossary.NewContext(context.Background(), glossary.Glossary{DoNotTranslate: []string{"Alice"}})
+	cache.Translate(context.Background(), "hello Alice", "en", "ja")
+	cache.Translate(ctx, "hello Alice", "en", "ja")
+	cache.Translate(ctx, "hello Alice", "en", "ja")
+	assert.Equal(t, 2, next.calls)
+}
+
+func TestNgramDetector(t *testing.T) {
+	d := NewNgramDetector()
+	tests := []struct {
+		text string
+		lang string
+	}{
+		{"Can you see my screen now?", "en"},
+		{"¿Puedes ver mi pantalla ahora?", "es"},
+		{"Est-ce que tu vois mon écran maintenant ?", "fr"},
+		{"Kannst du meinen Bildschirm jetzt sehen?", "de"},
+		{"Riesci a vedere il mio schermo adesso?", "it"},
+		{"Kun je mijn scherm nu zien?", "nl"},
+		{"今日の会議は三時からです", "ja"},
+		{"我们开始吧", "zh"},
+		{"안녕하세요", "ko"},
+		{"Привет всем", "ru"},
+		{"Привіт, як справи?", "uk"},
+	}
+	for _, tt := range tests {
+		lang, confidence, err := d.DetectLanguage(context.Background(), tt.text)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.lang, lang, tt.text)
+		assert.Greater(t, confidence, 0.6, tt.text)
+	}
+
+	// Script-only guesses do not rule out other languages of the script
+	for _, tt := range []struct{ text, detected, preferred string }{
+		{"سلام به همه، جلسه را شروع کنیم", "ar", "fa"},
+		{"Здравейте, да започваме срещата", "ru", "bg"},
+		{"会議資料共有", "zh", "ja"},
+		{"नमस्कार, आपण बैठक सुरू करूया", "hi", "mr"},
+		{"我們開始開會吧", "zh", "zh-Hant"},
+	} {
+		lang, _, _ := d.DetectLanguage(context.Background(), tt.text)
+		assert.Equal(t, tt.detected, lang, tt.text)
+		assert.True(t, SharesScript(lang, tt.preferred), tt.text)
+	}
+	assert.False(t, SharesScript("ja", "zh"))
+	assert.False(t, SharesScript("ru", "en"))
+	assert.False(t, SharesScript("en", "fr"))
+
+	// Short Latin-script texts are too ambiguous to judge
+	_, confidence, _ := d.DetectLanguage(context.Background(), "I agree")
+	assert.Zero(t, confidence)
+	lang, _, _ := d.DetectLanguage(context.Background(), "123 !!")
+	assert.Empty(t, lang)
+}
+
+func TestOpenAITranslator_DetectLanguage(t *testing.T) {
+	reply := "ja"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: reply}}},
+		})
+	}))
+	defer server.Close()
+
+	translator := NewOpenAITranslatorWithConfig(OpenAIConfig{BaseURL: server.URL})
+	lang, confidence, err := translator.DetectLanguage(context.Background(), "こんにちは")
+	assert.NoError(t, err)
+	assert.Equal(t, "ja", lang)
+	assert.Equal(t, 1.0, confidence)
+
+	reply = "The language is Japanese."
+	_, _, err = translator.DetectLanguage(context.Background(), "こんにちは")
+	assert.Error(t, err)
+}
+
+func TestOpenAITranslator_TranslateStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		assert.True(t, req.Stream)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, content := range []string{"Buenos", " días", " a todos"} {
+			chunk, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+				Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: content}}},
+			})
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	var partials []string
+	translator := NewOpenAITranslatorWithConfig(OpenAIConfig{BaseURL: server.URL})
+	translated, err := translator.TranslateStream(context.Background(), nil, "Good morning everyone", "en", "es", func(partial string) {
+		partials = append(partials, partial)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Buenos días a todos", translated)
+	assert.Equal(t, []string{"Buenos", "Buenos días", "Buenos días a todos"}, partials)
+}
+
+func TestTranslateStream_Wrappers(t *testing.T) {
+	next := &countingTranslator{}
+	cache, err := NewCachingTranslator(NewResilientTranslator(next, ResilienceOptions{}), CacheOptions{Size: 10})
+	assert.NoError(t, err)
+
+	// Translators without streaming support deliver the whole translation
+	translated, err := cache.TranslateStream(context.Background(), nil, "hello", "en", "ja", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "[ja] hello", translated)
+
+	// A streamed translation is cached
+	cache.TranslateStream(context.Background(), nil, "hello", "en", "ja", nil)
+	assert.Equal(t, 1, next.calls)
+}
+
+func TestOpenAITranslator_TranslateMulti(t *testing.T) {
+	var multiReply string
+	var requests []openai.ChatCompletionRequest
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+
+		content := multiReply
+		if req.ResponseFormat == nil {
+			// Single-language fallback; the prompt ends with the target
+			content = "single " + req.Messages[0].Content[len(req.Messages[0].Content)-2:]
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: content}}},
+		})
+	}))
+	defer server.Close()
+
+	prompt, err := ParsePrompt("From {{.From}} to {{.To}}", "")
+	assert.NoError(t, err)
+	translator := NewOpenAITranslatorWithConfig(OpenAIConfig{BaseURL: server.URL, MaxTokens: 100, Prompt: prompt})
+
+	t.Run("one request for all languages", func(t *testing.T) {
+		requests = nil
+		multiReply = "```json\n{\"ja\": \"こんにちは\", \"ES\": \"hola\"}\n```"
+		translations, err := translator.TranslateMulti(context.Background(), "hello", "en", []string{"ja", "es", "en", "ja"})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"ja": "こんにちは", "es": "hola", "en": "hello"}, translations)
+
+		assert.Len(t, requests, 1)
+		assert.Equal(t, openai.ChatCompletionResponseFormatTypeJSONObject, requests[0].ResponseFormat.Type)
+		assert.Equal(t, 200, requests[0].MaxTokens)
+		assert.Contains(t, requests[0].Messages[0].Content, "From en to ja, es")
+		assert.Contains(t, requests[0].Messages[0].Content, `"ja", "es"`)
+	})
+
+	t.Run("missing languages are translated separately", func(t *testing.T) {
+		requests = nil
+		multiReply = `{"ja": "こんにちは", "es": 42, "fr": ""}`
+		translations, err := translator.TranslateMulti(context.Background(), "hello", "en", []string{"ja", "es", "fr"})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"ja": "こんにちは", "es": "single es", "fr": "single fr"}, translations)
+		assert.Len(t, requests, 3)
+	})
+
+	t.Run("malformed reply falls back to per-language calls", func(t *testing.T) {
+		requests = nil
+		multiReply = "Sorry, I can't do that."
+		translations, err := translator.TranslateMulti(context.Background(), "hello", "en", []string{"ja", "es"})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"ja": "single ja", "es": "single es"}, translations)
+		assert.Len(t, requests, 3)
+	})
+}
+
+// multiRecorder is a MultiTranslator that records the languages requested
+type multiRecorder struct {
+	requested [][]string
+}
+
+func (m *multiRecorder) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	return "[" + toLang + "] " + text, nil
+}
+
+func (m *multiRecorder) TranslateMulti(ctx context.Context, text, fromLang string, toLangs []string) (map[string]string, error) {
+	m.requested = append(m.requested, toLangs)
+	translations := make(map[string]string, len(toLangs))
+	for _, lang := range toLangs {
+		translations[lang], _ = m.Translate(ctx, text, fromLang, lang)
+	}
+	return translations, nil
+}
+
+func TestTranslateMulti_Wrappers(t *testing.T) {
+	next := &multiRecorder{}
+	fallback := NewFallbackTranslator(0, Provider{Name: "multi", Translator: next})
+	cache, err := NewCachingTranslator(NewResilientTranslator(fallback, ResilienceOptions{}), CacheOptions{Size: 10})
+	assert.NoError(t, err)
+
+	cache.Translate(context.Background(), "hello", "en", "ja")
+	translations, err := cache.TranslateMulti(context.Background(), "hello", "en", []string{"ja", "es", "fr"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"ja": "[ja] hello", "es": "[es] hello", "fr": "[fr] hello"}, translations)
+
+	// Only languages missing from the cache are requested, in a single call
+	assert.Equal(t, [][]string{{"es", "fr"}}, next.requested)
+	cache.TranslateMulti(context.Background(), "hello", "en", []string{"ja", "es", "fr"})
+	assert.Len(t, next.requested, 1)
+
+	// Translators without multi-target support are called once per language
+	single := &recordingTranslator{reply: "hola"}
+	translations, err = translateMulti(context.Background(), single, "hello", "en", []string{"es", "en"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"es": "hola", "en": "hello"}, translations)
+}
+
+func TestLanguages(t *testing.T) {
+	deepL := providerServer(t, func(r *http.Request, body []byte) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/v2/languages", r.URL.Path)
+		assert.Equal(t, "target", r.URL.Query().Get("type"))
+		assert.Equal(t, "DeepL-Auth-Key secret", r.Header.Get("Authorization"))
+	}, http.StatusOK, `[{"language":"EN-US","name":"English (American)"},{"language":"JA","name":"Japanese"}]`)
+	libre := providerServer(t, func(r *http.Request, body []byte) {
+		assert.Equal(t, "/languages", r.URL.Path)
+	}, http.StatusOK, `[{"code":"ja","name":"Japanese"},{"code":"es","name":"Spanish"}]`)
+	azure := providerServer(t, func(r *http.Request, body []byte) {}, http.StatusServiceUnavailable, "down")
+
+	tags, err := NewDeepLTranslator(DeepLConfig{APIKey: "secret", BaseURL: deepL.URL}).Languages(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"EN-US", "JA"}, tags)
+
+	// A fallback chain supports the languages of every reachable provider
+	fallback := NewFallbackTranslator(0,
+		Provider{Name: "deepl", Translator: NewMaskingTranslator(NewDeepLTranslator(DeepLConfig{APIKey: "secret", BaseURL: deepL.URL}))},
+		Provider{Name: "azure", Translator: NewAzureTranslator(AzureConfig{Endpoint: azure.URL})},
+		Provider{Name: "libretranslate", Translator: NewLibreTranslateTranslator(LibreTranslateConfig{URL: libre.URL})},
+	)
+	tags, err = NewResilientTranslator(fallback, ResilienceOptions{}).Languages(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"EN-US", "JA", "ja", "es"}, tags)
+
+	_, err = NewFallbackTranslator(0, Provider{Name: "azure", Translator: NewAzureTranslator(AzureConfig{Endpoint: azure.URL})}).Languages(context.Background())
+	assert.Error(t, err)
+
+	// Translators that cannot list their languages are assumed to support all
+	tags, err = supportedLanguages(context.Background(), &countingTranslator{})
+	assert.NoError(t, err)
+	assert.Contains(t, tags, "ja")
+}
+
+func TestFormality(t *testing.T) {
+	f, err := ParseFormality(" Formal ")
+	assert.NoError(t, err)
+	assert.Equal(t, FormalityFormal, f)
+	_, err = ParseFormality("polite")
+	assert.Error(t, err)
+	assert.Equal(t, FormalityAuto, FormalityFromContext(context.Background()))
+
+	formal := NewFormalityContext(context.Background(), FormalityFormal)
+	system, _, err := DefaultPrompt().render(promptData(formal, "hello", "en", "ja"))
+	assert.NoError(t, err)
+	assert.Contains(t, system, "formal, polite register")
+	system, _, err = DefaultPrompt().render(promptData(context.Background(), "hello", "en", "ja"))
+	assert.NoError(t, err)
+	assert.NotContains(t, system, "register")
+
+	// DeepL is asked for the formality where the target language has one
+	server := providerServer(t, func(r *http.Request, body []byte) {
+		assert.JSONEq(t, `{"text":["hello"],"source_lang":"EN","target_lang":"DE","formality":"prefer_less"}`, string(body))
+	}, http.StatusOK, `{"translations":[{"text":"hallo"}]}`)
+	informal := NewFormalityContext(context.Background(), FormalityInformal)
+	_, err = NewDeepLTranslator(DeepLConfig{BaseURL: server.URL}).Translate(informal, "hello", "en", "de")
+	assert.NoError(t, err)
+
+	// Translations in different registers are cached separately
+	next := &countingTranslator{}
+	cache, err := NewCachingTranslator(next, CacheOptions{Size: 10})
+	assert.NoError(t, err)
+	cache.Translate(context.Background(), "hello", "en", "ja")
+	cache.Translate(NewFormalityContext(context.Background(), FormalityAuto), "hello", "en", "ja")
+	assert.Equal(t, 1, next.calls)
+	cache.Translate(formal, "hello", "en", "ja")
+	assert.Equal(t, 2, next.calls)
+}
+
+// usageRecorder records the usage reported to it
+type usageRecorder struct {
+	records []usage.Record
+	mu      sync.Mutex
+}
+
+func (r *usageRecorder) Record(ctx context.Context, model string, promptTokens, completionTokens int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a := usage.FromContext(ctx)
+	r.records = append(r.records, usage.Record{
+		Room:             a.Room,
+		User:             a.User,
+		Model:            model,
+		PromptTokens:     int64(promptTokens),
+		CompletionTokens: int64(completionTokens),
+	})
+}
+
+func TestOpenAITranslator_Usage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			assert.Nil(t, req.StreamOptions)
+			fmt.Fprint(w, `{"model":"gpt-4o-mini-2024-07-18","choices":[{"message":{"role":"assistant","content":"hola"}}],"usage":{"prompt_tokens":40,"completion_tokens":3,"total_tokens":43}}`)
+			return
+		}
+
+		// Usage of a stream arrives in a final chunk without choices
+		assert.True(t, req.StreamOptions != nil && req.StreamOptions.IncludeUsage)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"model":"gpt-4o-mini-2024-07-18","choices":[{"delta":{"content":"hola"}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"model":"gpt-4o-mini-2024-07-18","choices":[],"usage":{"prompt_tokens":50,"completion_tokens":4,"total_tokens":54}}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	recorder := &usageRecorder{}
+	translator := NewOpenAITranslatorWithConfig(OpenAIConfig{BaseURL: server.URL, Usage: recorder})
+	ctx := usage.NewContext(context.Background(), usage.Attribution{Room: "lobby", User: "alice@example.com"})
+
+	_, err := translator.Translate(ctx, "hello", "en", "es")
+	assert.NoError(t, err)
+	_, err = translator.TranslateStream(ctx, nil, "hello", "en", "es", nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []usage.Record{
+		{Room: "lobby", User: "alice@example.com", Model: "gpt-4o-mini-2024-07-18", PromptTokens: 40, CompletionTokens: 3},
+		{Room: "lobby", User: "alice@example.com", Model: "gpt-4o-mini-2024-07-18", PromptTokens: 50, CompletionTokens: 4},
+	}, recorder.records)
+}
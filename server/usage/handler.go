@@ -0,0 +1,147 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Total is the usage and estimated cost of one room, one user or everything
+type Total struct {
+	Key              string  `json:"key,omitempty"`
+	Requests         int64   `json:"requests"`
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	TotalTokens      int64   `json:"totalTokens"`
+	Cost             float64 `json:"cost"`
+	// UnpricedTokens counts tokens of models missing from the price table,
+	// which the cost leaves out
+	UnpricedTokens int64 `json:"unpricedTokens,omitempty"`
+}
+
+// add adds r and its cost to the total
+func (t *Total) add(r Record, prices PriceTable) {
+	t.Requests += r.Requests
+	t.PromptTokens += r.PromptTokens
+	t.CompletionTokens += r.CompletionTokens
+	t.TotalTokens += r.PromptTokens + r.CompletionTokens
+	if cost, ok := prices.Cost(r); ok {
+		t.Cost += cost
+	} else {
+		t.UnpricedTokens += r.PromptTokens + r.CompletionTokens
+	}
+}
+
+// Report is the response of the usage endpoint
+type Report struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	GroupBy string    `json:"groupBy"`
+	Groups  []Total   `json:"groups"`
+	Total   Total     `json:"total"`
+}
+
+// Handler serves usage reports
+type Handler struct {
+	tracker *Tracker
+	prices  PriceTable
+}
+
+// NewHandler creates a new usage Handler
+func NewHandler(tracker *Tracker, prices PriceTable) *Handler {
+	return &Handler{tracker: tracker, prices: prices}
+}
+
+// HandleGet handles GET /admin/usage?from=&to=&groupBy=room|user. from and to
+// are RFC 3339 times or dates and default to the start of the current month
+// and now; usage is counted by the hour, so partial hours are included.
+func (h *Handler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	now := time.Now().UTC()
+
+	from, err := parseTime(query.Get("from"), time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		http.Error(w, "Invalid from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTime(query.Get("to"), now)
+	if err != nil {
+		http.Error(w, "Invalid to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !to.After(from) {
+		http.Error(w, "to must be after from", http.StatusBadRequest)
+		return
+	}
+	groupBy := query.Get("groupBy")
+	if groupBy == "" {
+		groupBy = "room"
+	}
+	if groupBy != "room" && groupBy != "user" {
+		http.Error(w, "groupBy must be room or user", http.StatusBadRequest)
+		return
+	}
+
+	records, err := h.tracker.Query(from, to)
+	if err != nil {
+		log.Printf("Error querying usage: %v", err)
+		http.Error(w, "Failed to load usage", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.report(records, from, to, groupBy)); err != nil {
+		log.Printf("Error writing usage report: %v", err)
+	}
+}
+
+// report totals records by room or user, most expensive first
+func (h *Handler) report(records []Record, from, to time.Time, groupBy string) Report {
+	report := Report{From: from, To: to, GroupBy: groupBy, Groups: []Total{}}
+	groups := make(map[string]*Total)
+	for _, r := range records {
+		key := r.Room
+		if groupBy == "user" {
+			key = r.User
+		}
+		g, ok := groups[key]
+		if !ok {
+			g = &Total{Key: key}
+			groups[key] = g
+		}
+		g.add(r, h.prices)
+		report.Total.add(r, h.prices)
+	}
+
+	for _, g := range groups {
+		report.Groups = append(report.Groups, *g)
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		a, b := report.Groups[i], report.Groups[j]
+		if a.Cost != b.Cost {
+			return a.Cost > b.Cost
+		}
+		if a.TotalTokens != b.TotalTokens {
+			return a.TotalTokens > b.TotalTokens
+		}
+		return a.Key < b.Key
+	})
+	return report
+}
+
+// parseTime parses an RFC 3339 time or a date, returning def for an empty value
+func parseTime(value string, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("want an RFC 3339 time or a YYYY-MM-DD date, got %q", value)
+}
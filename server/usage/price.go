@@ -0,0 +1,85 @@
+package usage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Price is what a model costs, in US dollars per million tokens
+type Price struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// PriceTable maps model names to prices. Versioned model names such as
+// gpt-4o-mini-2024-07-18 use the price of their longest listed prefix.
+type PriceTable map[string]Price
+
+// DefaultPrices returns list prices for the OpenAI models most used for
+// translation
+func DefaultPrices() PriceTable {
+	return PriceTable{
+		"gpt-4o-mini":   {Prompt: 0.15, Completion: 0.60},
+		"gpt-4o":        {Prompt: 2.50, Completion: 10.00},
+		"gpt-4.1-mini":  {Prompt: 0.40, Completion: 1.60},
+		"gpt-4.1-nano":  {Prompt: 0.10, Completion: 0.40},
+		"gpt-4.1":       {Prompt: 2.00, Completion: 8.00},
+		"gpt-3.5-turbo": {Prompt: 0.50, Completion: 1.50},
+	}
+}
+
+// ParsePriceTable parses prices written as comma-separated
+// model=prompt/completion entries, such as "gpt-4o-mini=0.15/0.60", in
+// dollars per million tokens
+func ParsePriceTable(s string) (PriceTable, error) {
+	prices := make(PriceTable)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		model, rates, ok := strings.Cut(entry, "=")
+		prompt, completion, ok2 := strings.Cut(rates, "/")
+		if !ok || !ok2 || strings.TrimSpace(model) == "" {
+			return nil, fmt.Errorf("invalid price %q, want model=prompt/completion", entry)
+		}
+		var p Price
+		var err error
+		if p.Prompt, err = strconv.ParseFloat(strings.TrimSpace(prompt), 64); err != nil || p.Prompt < 0 {
+			return nil, fmt.Errorf("invalid prompt price in %q", entry)
+		}
+		if p.Completion, err = strconv.ParseFloat(strings.TrimSpace(completion), 64); err != nil || p.Completion < 0 {
+			return nil, fmt.Errorf("invalid completion price in %q", entry)
+		}
+		prices[strings.TrimSpace(model)] = p
+	}
+	return prices, nil
+}
+
+// lookup returns the price of model, if it is known
+func (t PriceTable) lookup(model string) (Price, bool) {
+	if p, ok := t[model]; ok {
+		return p, true
+	}
+	best := ""
+	for name := range t {
+		if strings.HasPrefix(model, name+"-") && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return t[best], true
+}
+
+// Cost returns the estimated cost of r in US dollars, and false if its model
+// has no price
+func (t PriceTable) Cost(r Record) (float64, bool) {
+	p, ok := t.lookup(r.Model)
+	if !ok {
+		return 0, false
+	}
+	return (float64(r.PromptTokens)*p.Prompt + float64(r.CompletionTokens)*p.Completion) / 1e6, true
+}
@@ -0,0 +1,124 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Sink stores flushed usage records. Records for the same hour, room, user
+// and model may be written more than once and are summed when queried.
+type Sink interface {
+	Write(records []Record) error
+	// Query returns the records whose hour overlaps [from, to)
+	Query(from, to time.Time) ([]Record, error)
+}
+
+// MemorySink implements the Sink interface in memory
+type MemorySink struct {
+	records []Record
+	mu      sync.RWMutex
+}
+
+// NewMemorySink creates an empty MemorySink
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// Write stores records
+func (s *MemorySink) Write(records []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, records...)
+	return nil
+}
+
+// Query returns the stored records whose hour overlaps [from, to)
+func (s *MemorySink) Query(from, to time.Time) ([]Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []Record
+	for _, r := range s.records {
+		if r.inRange(from, to) {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+// FileSink implements the Sink interface with an append-only JSON Lines file
+type FileSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileSink creates a FileSink writing to path, creating its directory if
+// needed
+func NewFileSink(path string) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create usage directory: %w", err)
+	}
+	return &FileSink{path: path}, nil
+}
+
+// Write appends records to the file
+func (s *FileSink) Write(records []Record) error {
+	var data []byte
+	for _, r := range records {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("failed to encode usage record: %w", err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open usage file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("failed to write usage file: %w", err)
+	}
+	return nil
+}
+
+// Query reads the records whose hour overlaps [from, to) from the file
+func (s *FileSink) Query(from, to time.Time) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage file: %w", err)
+	}
+	defer f.Close()
+
+	var result []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("failed to decode usage record: %w", err)
+		}
+		if r.inRange(from, to) {
+			result = append(result, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage file: %w", err)
+	}
+	return result, nil
+}
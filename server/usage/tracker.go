@@ -0,0 +1,142 @@
+package usage
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Tracker aggregates token usage in memory by hour, room, user and model and
+// periodically flushes the totals to a Sink
+type Tracker struct {
+	sink    Sink
+	now     func() time.Time
+	pending map[recordKey]*Record
+	mu      sync.Mutex
+	flushMu sync.Mutex // serializes flushes so records reach the sink in order
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewTracker creates a Tracker and starts flushing to sink every
+// flushInterval. A zero interval only flushes on Flush and Close.
+func NewTracker(sink Sink, flushInterval time.Duration) *Tracker {
+	t := &Tracker{
+		sink:    sink,
+		now:     time.Now,
+		pending: make(map[recordKey]*Record),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if flushInterval > 0 {
+		go t.flushLoop(flushInterval)
+	} else {
+		close(t.done)
+	}
+	return t
+}
+
+// Record adds the usage of one model response to the totals of the room and
+// user ctx attributes it to
+func (t *Tracker) Record(ctx context.Context, model string, promptTokens, completionTokens int) {
+	a := FromContext(ctx)
+	r := Record{
+		Start:            t.now().UTC().Truncate(time.Hour),
+		Room:             a.Room,
+		User:             a.User,
+		Model:            model,
+		Requests:         1,
+		PromptTokens:     int64(promptTokens),
+		CompletionTokens: int64(completionTokens),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.addLocked(r)
+}
+
+// addLocked merges r into the pending totals
+func (t *Tracker) addLocked(r Record) {
+	if existing, ok := t.pending[r.key()]; ok {
+		existing.add(r)
+		return
+	}
+	t.pending[r.key()] = &r
+}
+
+// Query returns the records whose hour overlaps [from, to), including usage
+// not flushed yet
+func (t *Tracker) Query(from, to time.Time) ([]Record, error) {
+	t.flushMu.Lock()
+	defer t.flushMu.Unlock()
+
+	records, err := t.sink.Query(from, to)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, r := range t.pending {
+		if r.inRange(from, to) {
+			records = append(records, *r)
+		}
+	}
+	return records, nil
+}
+
+// Flush writes the pending totals to the sink. On failure they are kept for
+// the next flush.
+func (t *Tracker) Flush() error {
+	t.flushMu.Lock()
+	defer t.flushMu.Unlock()
+
+	t.mu.Lock()
+	records := make([]Record, 0, len(t.pending))
+	for _, r := range t.pending {
+		records = append(records, *r)
+	}
+	t.pending = make(map[recordKey]*Record)
+	t.mu.Unlock()
+
+	if len(records) == 0 {
+		return nil
+	}
+	if err := t.sink.Write(records); err != nil {
+		t.mu.Lock()
+		for _, r := range records {
+			t.addLocked(r)
+		}
+		t.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// flushLoop flushes every interval until the tracker is closed
+func (t *Tracker) flushLoop(interval time.Duration) {
+	defer close(t.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			if err := t.Flush(); err != nil {
+				log.Printf("Error flushing usage: %v", err)
+			}
+		}
+	}
+}
+
+// Close stops the periodic flush and flushes what is left
+func (t *Tracker) Close() error {
+	t.once.Do(func() {
+		close(t.stop)
+	})
+	<-t.done
+	return t.Flush()
+}
@@ -0,0 +1,81 @@
+// Package usage accounts for the tokens translation models consume, per room
+// and per user, and estimates what they cost.
+package usage
+
+import (
+	"context"
+	"time"
+)
+
+// Attribution identifies the room and user a model request was made for
+type Attribution struct {
+	Room string
+	User string // the sender's email
+}
+
+// attributionKey is the context key for the Attribution of a request
+type attributionKey struct{}
+
+// NewContext returns a copy of ctx attributing model usage to a
+func NewContext(ctx context.Context, a Attribution) context.Context {
+	return context.WithValue(ctx, attributionKey{}, a)
+}
+
+// FromContext returns the Attribution carried by ctx, which is empty if
+// there is none
+func FromContext(ctx context.Context) Attribution {
+	a, _ := ctx.Value(attributionKey{}).(Attribution)
+	return a
+}
+
+// Recorder receives the token usage reported with each model response
+type Recorder interface {
+	Record(ctx context.Context, model string, promptTokens, completionTokens int)
+}
+
+// Recorders passes usage on to each of its Recorders
+type Recorders []Recorder
+
+// Record implements the Recorder interface
+func (rs Recorders) Record(ctx context.Context, model string, promptTokens, completionTokens int) {
+	for _, r := range rs {
+		r.Record(ctx, model, promptTokens, completionTokens)
+	}
+}
+
+// Record is the usage of one model by one user in one room over the hour
+// starting at Start
+type Record struct {
+	Start            time.Time `json:"start"`
+	Room             string    `json:"room"`
+	User             string    `json:"user"`
+	Model            string    `json:"model"`
+	Requests         int64     `json:"requests"`
+	PromptTokens     int64     `json:"promptTokens"`
+	CompletionTokens int64     `json:"completionTokens"`
+}
+
+// recordKey identifies the Record a request is aggregated into
+type recordKey struct {
+	start time.Time
+	room  string
+	user  string
+	model string
+}
+
+// key returns the aggregation key of r
+func (r Record) key() recordKey {
+	return recordKey{start: r.Start, room: r.Room, user: r.User, model: r.Model}
+}
+
+// add adds the counts of other to r
+func (r *Record) add(other Record) {
+	r.Requests += other.Requests
+	r.PromptTokens += other.PromptTokens
+	r.CompletionTokens += other.CompletionTokens
+}
+
+// inRange reports whether r's hour overlaps [from, to)
+func (r Record) inRange(from, to time.Time) bool {
+	return r.Start.Add(time.Hour).After(from) && r.Start.Before(to)
+}
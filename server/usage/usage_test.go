@@ -0,0 +1,171 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingSink fails every write
+type failingSink struct {
+	MemorySink
+}
+
+func (s *failingSink) Write(records []Record) error {
+	return errors.New("disk full")
+}
+
+// newTestTracker creates a Tracker without periodic flushing whose clock
+// reads *now
+func newTestTracker(sink Sink, now *time.Time) *Tracker {
+	tracker := NewTracker(sink, 0)
+	tracker.now = func() time.Time { return *now }
+	return tracker
+}
+
+func attributed(room, user string) context.Context {
+	return NewContext(context.Background(), Attribution{Room: room, User: user})
+}
+
+func TestTracker(t *testing.T) {
+	now := time.Date(2026, 3, 14, 9, 15, 0, 0, time.UTC)
+	sink := NewMemorySink()
+	tracker := newTestTracker(sink, &now)
+
+	tracker.Record(attributed("lobby", "alice@example.com"), "gpt-4o-mini", 100, 10)
+	tracker.Record(attributed("lobby", "alice@example.com"), "gpt-4o-mini", 50, 5)
+	tracker.Record(attributed("lobby", "bob@example.com"), "gpt-4o-mini", 20, 2)
+
+	// Unflushed usage is queryable and aggregated by hour, room, user and model
+	records, err := tracker.Query(now.Add(-time.Hour), now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	assert.NoError(t, tracker.Flush())
+	stored, _ := sink.Query(now.Add(-time.Hour), now.Add(time.Hour))
+	assert.ElementsMatch(t, records, stored)
+	for _, r := range stored {
+		if r.User == "alice@example.com" {
+			assert.Equal(t, Record{
+				Start: time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC), Room: "lobby", User: "alice@example.com",
+				Model: "gpt-4o-mini", Requests: 2, PromptTokens: 150, CompletionTokens: 15,
+			}, r)
+		}
+	}
+
+	// Usage in the same hour after a flush is stored separately
+	tracker.Record(attributed("lobby", "alice@example.com"), "gpt-4o-mini", 1, 1)
+	records, _ = tracker.Query(now.Add(-time.Hour), now.Add(time.Hour))
+	assert.Len(t, records, 3)
+
+	// Hours outside the range are left out
+	records, _ = tracker.Query(now.Add(time.Hour), now.Add(2*time.Hour))
+	assert.Empty(t, records)
+}
+
+func TestTracker_FlushFailure(t *testing.T) {
+	now := time.Now()
+	tracker := newTestTracker(&failingSink{}, &now)
+	tracker.Record(attributed("lobby", "alice@example.com"), "gpt-4o-mini", 100, 10)
+
+	// Usage that could not be written is kept for the next flush
+	assert.Error(t, tracker.Flush())
+	records, err := tracker.Query(now.Add(-time.Hour), now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Error(t, tracker.Close())
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "usage.jsonl")
+	sink, err := NewFileSink(path)
+	assert.NoError(t, err)
+
+	start := time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC)
+	records, err := sink.Query(start, start.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+
+	written := []Record{
+		{Start: start, Room: "lobby", User: "alice@example.com", Model: "gpt-4o", Requests: 1, PromptTokens: 10, CompletionTokens: 2},
+		{Start: start.Add(24 * time.Hour), Room: "lobby", User: "bob@example.com", Model: "gpt-4o", Requests: 1, PromptTokens: 20, CompletionTokens: 4},
+	}
+	assert.NoError(t, sink.Write(written))
+
+	reopened, _ := NewFileSink(path)
+	records, err = reopened.Query(start, start.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, written[:1], records)
+}
+
+func TestPriceTable(t *testing.T) {
+	prices, err := ParsePriceTable("gpt-4o-mini=0.15/0.60, my-model = 1/2")
+	assert.NoError(t, err)
+	assert.Equal(t, PriceTable{"gpt-4o-mini": {Prompt: 0.15, Completion: 0.60}, "my-model": {Prompt: 1, Completion: 2}}, prices)
+
+	for _, invalid := range []string{"gpt-4o", "gpt-4o=1", "=1/2", "gpt-4o=a/2", "gpt-4o=1/-2"} {
+		_, err := ParsePriceTable(invalid)
+		assert.Error(t, err, invalid)
+	}
+
+	defaults := DefaultPrices()
+	cost, ok := defaults.Cost(Record{Model: "gpt-4o", PromptTokens: 1_000_000, CompletionTokens: 100_000})
+	assert.True(t, ok)
+	assert.InDelta(t, 3.50, cost, 1e-9)
+
+	// Versioned names use the longest matching prefix
+	cost, ok = defaults.Cost(Record{Model: "gpt-4o-mini-2024-07-18", PromptTokens: 1_000_000})
+	assert.True(t, ok)
+	assert.InDelta(t, 0.15, cost, 1e-9)
+
+	_, ok = defaults.Cost(Record{Model: "llama3", PromptTokens: 1})
+	assert.False(t, ok)
+}
+
+func TestHandler(t *testing.T) {
+	now := time.Now().UTC()
+	tracker := newTestTracker(NewMemorySink(), &now)
+	tracker.Record(attributed("lobby", "alice@example.com"), "gpt-4o", 1_000_000, 0)
+	tracker.Record(attributed("standup", "alice@example.com"), "gpt-4o-mini", 1_000_000, 0)
+	tracker.Record(attributed("standup", "bob@example.com"), "llama3", 500, 100)
+	handler := NewHandler(tracker, DefaultPrices())
+
+	get := func(query string) (*httptest.ResponseRecorder, Report) {
+		w := httptest.NewRecorder()
+		handler.HandleGet(w, httptest.NewRequest(http.MethodGet, "/admin/usage"+query, nil))
+		var report Report
+		json.NewDecoder(w.Body).Decode(&report)
+		return w, report
+	}
+
+	w, report := get("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "room", report.GroupBy)
+	assert.Len(t, report.Groups, 2)
+	assert.Equal(t, "lobby", report.Groups[0].Key)
+	assert.InDelta(t, 2.50, report.Groups[0].Cost, 1e-9)
+	assert.Equal(t, int64(600), report.Groups[1].UnpricedTokens)
+	assert.Equal(t, int64(3), report.Total.Requests)
+	assert.Equal(t, int64(2_000_600), report.Total.TotalTokens)
+	assert.InDelta(t, 2.65, report.Total.Cost, 1e-9)
+
+	_, report = get("?groupBy=user")
+	assert.Equal(t, []string{"alice@example.com", "bob@example.com"}, []string{report.Groups[0].Key, report.Groups[1].Key})
+
+	// A range before any usage is empty
+	_, report = get("?from=2020-01-01&to=2020-02-01")
+	assert.Empty(t, report.Groups)
+	assert.Zero(t, report.Total.Requests)
+
+	for _, query := range []string{"?groupBy=model", "?from=yesterday", "?from=2026-02-01&to=2026-01-01"} {
+		w, _ := get(query)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
@@ -0,0 +1,28 @@
+package websocket
+
+import (
+	"context"
+	"log"
+
+	"shabe/server/chat"
+	"shabe/server/glossary"
+	"shabe/server/usage"
+)
+
+// translationContext returns the context for translations made on client's
+// behalf in room. It carries the glossary that applies in room, attributes
+// model usage to the room and the client's email, and takes its workers from
+// the room's share of the pool.
+func (ws *WebSocket) translationContext(client *chat.Client, room *chat.Room) context.Context {
+	ctx := usage.NewContext(client.Context(), usage.Attribution{Room: room.GetID(), User: client.GetEmail()})
+	ctx = context.WithValue(ctx, roomKey{}, room.GetID())
+	if ws.config.Glossaries == nil {
+		return ctx
+	}
+	g, err := glossary.Resolve(ws.config.Glossaries, room.GetID())
+	if err != nil {
+		log.Printf("Error loading glossary for room %s: %v", room.GetID(), err)
+		return ctx
+	}
+	return glossary.NewContext(ctx, g)
+}
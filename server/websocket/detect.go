@@ -0,0 +1,57 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"shabe/server/chat"
+	"shabe/server/language"
+	"shabe/server/translate"
+)
+
+// detectLanguage returns the language text is written in, falling back to the
+// sender's preferred language if detection is disabled, fails or is unsure
+func (ws *WebSocket) detectLanguage(ctx context.Context, sender *chat.Client, text string) string {
+	preferred := sender.GetLanguage()
+	if ws.config.Detector == nil {
+		return preferred
+	}
+
+	if ws.config.TranslationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ws.config.TranslationTimeout)
+		defer cancel()
+	}
+
+	lang, confidence, err := ws.config.Detector.DetectLanguage(ctx, text)
+	if err != nil {
+		log.Printf("Language detection error: %v", err)
+		return preferred
+	}
+	// A guess made from the script alone, such as ar for Persian or zh for
+	// kanji-only Japanese, does not override a preference written in it
+	if lang == "" || confidence < ws.config.DetectionThreshold || sameLanguage(lang, preferred) || translate.SharesScript(lang, preferred) {
+		return preferred
+	}
+
+	log.Printf("Detected %s (%.2f) in message from %s, who prefers %s", lang, confidence, sender.GetName(), preferred)
+	return lang
+}
+
+// sameLanguage reports whether two language codes name the same language,
+// ignoring case. A bare language such as en matches any of its variants
+// written in the same script, while two different variants such as zh-Hans
+// and zh-Hant, or zh (Simplified) and zh-Hant, do not match.
+func sameLanguage(a, b string) bool {
+	if strings.EqualFold(a, b) {
+		return true
+	}
+	baseA, _, variantA := strings.Cut(a, "-")
+	baseB, _, variantB := strings.Cut(b, "-")
+	if (variantA && variantB) || !strings.EqualFold(baseA, baseB) {
+		return false
+	}
+	scriptA, scriptB := language.Script(a), language.Script(b)
+	return scriptA == "" || scriptB == "" || scriptA == scriptB
+}
@@ -0,0 +1,57 @@
+package websocket
+
+import (
+	"context"
+
+	"shabe/server/chat"
+	"shabe/server/translate"
+)
+
+// target identifies recipients who receive the same translation
+type target struct {
+	lang      string
+	formality translate.Formality
+}
+
+// context returns ctx asking translators for the target's formality
+func (t target) context(ctx context.Context) context.Context {
+	return translate.NewFormalityContext(ctx, t.formality)
+}
+
+// clientFormality returns the formality of client's translations: its own
+// preference, or the room default when it chose auto
+func clientFormality(client *chat.Client, room *chat.Room) translate.Formality {
+	if f := translate.Formality(client.GetFormality()); f != "" && f != translate.FormalityAuto {
+		return f
+	}
+	if f := translate.Formality(room.GetFormality()); f != "" {
+		return f
+	}
+	return translate.FormalityAuto
+}
+
+// groupByTarget groups the room's clients by preferred language and
+// formality, skipping the sender
+func groupByTarget(room *chat.Room, sender *chat.Client) map[target][]*chat.Client {
+	groups := make(map[target][]*chat.Client)
+	for _, c := range room.GetClients() {
+		if c == sender {
+			continue
+		}
+		tgt := target{lang: c.GetLanguage(), formality: clientFormality(c, room)}
+		groups[tgt] = append(groups[tgt], c)
+	}
+	return groups
+}
+
+// recordTranslation adds a delivered translation to the per-language map kept
+// in history and transcripts. When a language was translated in several
+// registers the one the translator chose itself is kept.
+func recordTranslation(translations map[string]string, tgt target, fromLang, text string) {
+	if sameLanguage(tgt.lang, fromLang) {
+		return
+	}
+	if _, ok := translations[tgt.lang]; !ok || tgt.formality == translate.FormalityAuto {
+		translations[tgt.lang] = text
+	}
+}
@@ -0,0 +1,90 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"shabe/server/chat"
+	"shabe/server/translate"
+)
+
+// replayHistory sends messages from before the client joined, translated into
+// the client's language and formality. Translations delivered at the time are
+// reused unless the client asked for a particular formality; the rest run
+// concurrently on the worker pool but messages are delivered in their
+// original order. A client over quota gets any stored translation and the
+// original text otherwise. Translations are abandoned once ctx is done.
+func (ws *WebSocket) replayHistory(ctx context.Context, client *chat.Client, room *chat.Room, backlog []chat.HistoryMessage) {
+	if len(backlog) == 0 {
+		return
+	}
+
+	tgt := target{lang: client.GetLanguage(), formality: clientFormality(client, room)}
+	ctx = tgt.context(ctx)
+	translated := make([]string, len(backlog))
+	allowed := ws.withinQuota(client, false)
+
+	var wg sync.WaitGroup
+	for i, entry := range backlog {
+		if text, ok := entry.Translations[tgt.lang]; ok && (tgt.formality == translate.FormalityAuto || !allowed) {
+			translated[i] = text
+			continue
+		}
+		if !allowed {
+			translated[i] = entry.Text
+			continue
+		}
+		wg.Add(1)
+		release := ws.workers.acquire(ctx)
+		go func(i int, entry chat.HistoryMessage) {
+			defer wg.Done()
+			defer release()
+			translated[i] = ws.translateText(ctx, entry.Text, entry.Language, tgt.lang, nil, nil)
+		}(i, entry)
+	}
+	wg.Wait()
+
+	log.Printf("Replaying %d messages to client %s", len(backlog), client.GetName())
+	for i, entry := range backlog {
+		err := client.Send(Message{
+			Type:           TypeMessage,
+			Text:           translated[i],
+			Name:           entry.SenderName,
+			SourceLanguage: entry.Language,
+			Timestamp:      entry.Timestamp.UnixMilli(),
+			History:        true,
+		})
+		if err != nil {
+			log.Printf("Error replaying history to client %s: %v", client.GetName(), err)
+			return
+		}
+	}
+}
+
+// recentContext returns the room's latest messages to use as translation
+// context, or nil if context-aware translation is disabled
+func (ws *WebSocket) recentContext(room *chat.Room) []chat.HistoryMessage {
+	if ws.config.ContextTurns <= 0 {
+		return nil
+	}
+	history := room.GetHistory()
+	if len(history) > ws.config.ContextTurns {
+		history = history[len(history)-ws.config.ContextTurns:]
+	}
+	return history
+}
+
+// conversationTurns converts room history into translation context for toLang
+func conversationTurns(history []chat.HistoryMessage, toLang string) []translate.Turn {
+	turns := make([]translate.Turn, 0, len(history))
+	for _, h := range history {
+		turns = append(turns, translate.Turn{
+			Speaker:     h.SenderName,
+			Language:    h.Language,
+			Text:        h.Text,
+			Translation: h.Translations[toLang],
+		})
+	}
+	return turns
+}
@@ -0,0 +1,178 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"shabe/server/chat"
+)
+
+// maxUtteranceIDLength bounds the utterance IDs clients may send
+const maxUtteranceIDLength = 64
+
+// utteranceID returns the ID of the frames for an utterance of client. It is
+// scoped to the sender so a client cannot replace someone else's messages
+// on recipients' screens by reusing their ID.
+func utteranceID(client *chat.Client, id string) string {
+	return client.GetID() + ":" + id
+}
+
+// utterance is a sentence a client is still speaking
+type utterance struct {
+	id         string
+	text       string // latest interim text received
+	translated string // interim text most recently translated
+	timer      *time.Timer
+	inFlight   bool
+	final      bool
+}
+
+// interimTracker translates a client's interim transcripts. Only the latest
+// utterance is tracked, and it is translated at most once per InterimInterval
+// and only when its text has changed, so interim traffic costs little more
+// than the final message.
+type interimTracker struct {
+	ws     *WebSocket
+	client *chat.Client
+	room   *chat.Room
+
+	mu      sync.Mutex
+	current *utterance
+}
+
+// newInterimTracker creates an interimTracker for a client in a room
+func newInterimTracker(ws *WebSocket, client *chat.Client, room *chat.Room) *interimTracker {
+	return &interimTracker{ws: ws, client: client, room: room}
+}
+
+// update records interim text for an utterance and schedules its translation
+func (t *interimTracker) update(msg Message) error {
+	if t.ws.config.InterimInterval <= 0 || msg.ID == "" || msg.Text == "" || len(msg.ID) > maxUtteranceIDLength {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.current == nil || t.current.id != msg.ID {
+		// The speaker has moved on; abandon the previous utterance
+		t.stopLocked()
+		t.current = &utterance{id: msg.ID}
+	}
+	u := t.current
+	if u.final {
+		return nil
+	}
+	u.text = msg.Text
+	if u.timer == nil && !u.inFlight {
+		u.timer = time.AfterFunc(t.ws.config.InterimInterval, func() { t.flush(u) })
+	}
+	return nil
+}
+
+// finish marks an utterance as final so no interim update for it is sent
+// after the final message
+func (t *interimTracker) finish(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current != nil && t.current.id == id {
+		t.stopLocked()
+	}
+}
+
+// stop abandons any pending interim translation
+func (t *interimTracker) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopLocked()
+}
+
+func (t *interimTracker) stopLocked() {
+	if t.current == nil {
+		return
+	}
+	t.current.final = true
+	if t.current.timer != nil {
+		t.current.timer.Stop()
+		t.current.timer = nil
+	}
+}
+
+// flush translates the utterance's latest text and sends it to the rest of
+// the room, then reschedules itself if more text arrived meanwhile
+func (t *interimTracker) flush(u *utterance) {
+	t.mu.Lock()
+	u.timer = nil
+	if u.final || u.text == u.translated {
+		t.mu.Unlock()
+		return
+	}
+	text := u.text
+	u.inFlight = true
+	t.mu.Unlock()
+
+	// Interim text is too fragmentary for language detection or context
+	fromLang := t.client.GetLanguage()
+	ctx := t.ws.translationContext(t.client, t.room)
+	groups := groupByTarget(t.room, t.client)
+	var translations map[target]string
+	if t.ws.withinQuota(t.client, false) {
+		translations = t.ws.translateAll(ctx, groups, text, fromLang)
+	} else {
+		translations = untranslated(groups, text)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u.inFlight = false
+	u.translated = text
+	if u.final {
+		return
+	}
+	// Sent under the lock so an update can never overtake the final message
+	for tgt, recipients := range groups {
+		for _, recipient := range recipients {
+			err := recipient.Send(Message{
+				Type:           TypeInterim,
+				ID:             utteranceID(t.client, u.id),
+				Text:           translations[tgt],
+				Name:           t.client.GetName(),
+				SourceLanguage: fromLang,
+			})
+			if err != nil {
+				log.Printf("Error sending interim message to client %s: %v", recipient.GetName(), err)
+			}
+		}
+	}
+	if u.text != text {
+		u.timer = time.AfterFunc(t.ws.config.InterimInterval, func() { t.flush(u) })
+	}
+}
+
+// translateAll translates text for every group, with a single multi-target
+// request where possible and on the worker pool otherwise
+func (ws *WebSocket) translateAll(ctx context.Context, groups map[target][]*chat.Client, text, fromLang string) map[target]string {
+	if translations, ok := ws.translateMulti(ctx, groups, text, fromLang); ok {
+		return translations
+	}
+
+	translations := make(map[target]string, len(groups))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for tgt := range groups {
+		wg.Add(1)
+		release := ws.workers.acquire(ctx)
+		go func(tgt target) {
+			defer wg.Done()
+			defer release()
+			translated := ws.translateText(tgt.context(ctx), text, fromLang, tgt.lang, nil, nil)
+			mu.Lock()
+			translations[tgt] = translated
+			mu.Unlock()
+		}(tgt)
+	}
+	wg.Wait()
+	return translations
+}
@@ -0,0 +1,60 @@
+package websocket
+
+import (
+	"context"
+	"log"
+
+	"shabe/server/chat"
+	"shabe/server/translate"
+)
+
+// translateMulti translates text for every group with a single multi-target
+// request per formality. ok is false when the translator has no multi-target
+// support or fewer than two groups need translating, in which case the
+// caller translates group by group. On failure every group gets the original
+// text, as with translateText.
+func (ws *WebSocket) translateMulti(ctx context.Context, groups map[target][]*chat.Client, text, fromLang string) (translations map[target]string, ok bool) {
+	mt, isMulti := ws.translator.(translate.MultiTranslator)
+	if !ws.config.MultiTarget || !isMulti {
+		return nil, false
+	}
+
+	translations = make(map[target]string, len(groups))
+	byFormality := make(map[translate.Formality][]string)
+	pending := 0
+	for tgt := range groups {
+		if sameLanguage(tgt.lang, fromLang) {
+			translations[tgt] = text
+		} else {
+			byFormality[tgt.formality] = append(byFormality[tgt.formality], tgt.lang)
+			pending++
+		}
+	}
+	if pending < 2 {
+		return nil, false
+	}
+
+	if ws.config.TranslationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ws.config.TranslationTimeout)
+		defer cancel()
+	}
+
+	defer ws.workers.acquire(ctx)()
+	for formality, langs := range byFormality {
+		translated, err := mt.TranslateMulti(translate.NewFormalityContext(ctx, formality), text, fromLang, langs)
+		if err != nil {
+			log.Printf("Translation error: %v", err)
+		} else {
+			ws.chargeQuota(ctx, text, len(langs))
+		}
+		for _, lang := range langs {
+			if t, found := translated[lang]; err == nil && found {
+				translations[target{lang: lang, formality: formality}] = t
+			} else {
+				translations[target{lang: lang, formality: formality}] = text
+			}
+		}
+	}
+	return translations, true
+}
@@ -0,0 +1,69 @@
+package websocket
+
+import (
+	"log"
+
+	"shabe/server/chat"
+)
+
+// Participant describes a room member in presence events
+type Participant struct {
+	ClientID  string `json:"clientId"`
+	Name      string `json:"name"`
+	Language  string `json:"language"`
+	EmailHash string `json:"emailHash"`
+}
+
+// newParticipant returns the presence information for a client
+func newParticipant(client *chat.Client) Participant {
+	return Participant{
+		ClientID:  client.GetID(),
+		Name:      client.GetName(),
+		Language:  client.GetLanguage(),
+		EmailHash: client.GetEmailHash(),
+	}
+}
+
+// sendRoster sends a snapshot of everyone in the room to a client. The
+// message's clientId identifies the recipient within the roster.
+func (ws *WebSocket) sendRoster(client *chat.Client, room *chat.Room) {
+	clients := room.GetClients()
+	participants := make([]Participant, 0, len(clients))
+	for _, c := range clients {
+		participants = append(participants, newParticipant(c))
+	}
+
+	err := client.Send(Message{
+		Type:         TypeRoster,
+		ClientID:     client.GetID(),
+		Participants: participants,
+	})
+	if err != nil {
+		log.Printf("Error sending roster to client %s: %v", client.GetName(), err)
+	}
+}
+
+// broadcastPresence tells everyone else in the room about a change to subject
+func (ws *WebSocket) broadcastPresence(room *chat.Room, msgType string, subject *chat.Client) {
+	p := newParticipant(subject)
+	msg := Message{
+		Type:      msgType,
+		ClientID:  p.ClientID,
+		Name:      p.Name,
+		Language:  p.Language,
+		EmailHash: p.EmailHash,
+	}
+
+	room.BroadcastMessage(func(c *chat.Client) error {
+		if c == subject {
+			return nil
+		}
+		return c.Send(msg)
+	})
+}
+
+// leaveRoom removes a client from its room and tells the remaining members
+func (ws *WebSocket) leaveRoom(room *chat.Room, client *chat.Client) {
+	ws.roomManager.LeaveRoom(room, client)
+	ws.broadcastPresence(room, TypeLeave, client)
+}
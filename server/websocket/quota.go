@@ -0,0 +1,65 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log"
+	"unicode/utf8"
+
+	"shabe/server/chat"
+	"shabe/server/quota"
+)
+
+// withinQuota reports whether translations may be made on client's behalf.
+// If the client has used up a quota and notify is set, it is sent a
+// quota_exceeded message.
+func (ws *WebSocket) withinQuota(client *chat.Client, notify bool) bool {
+	if ws.config.Quotas == nil {
+		return true
+	}
+	err := ws.config.Quotas.Check(client.GetEmail())
+	if err == nil {
+		return true
+	}
+	if notify {
+		msg := Message{Type: TypeQuotaExceeded, Text: err.Error()}
+		var exceeded *quota.Exceeded
+		if errors.As(err, &exceeded) {
+			msg.Quota = exceeded
+		}
+		if err := ws.sendMessage(client, msg); err != nil {
+			log.Printf("Error sending quota status to client %s: %v", client.GetName(), err)
+		}
+	}
+	return false
+}
+
+// chargeQuota counts text, translated into targets languages, against the
+// quota of the user ctx attributes usage to
+func (ws *WebSocket) chargeQuota(ctx context.Context, text string, targets int) {
+	if ws.config.Quotas != nil {
+		ws.config.Quotas.ChargeChars(ctx, utf8.RuneCountInString(text)*targets)
+	}
+}
+
+// untranslated gives every group the original text
+func untranslated(groups map[target][]*chat.Client, text string) map[target]string {
+	translations := make(map[target]string, len(groups))
+	for tgt := range groups {
+		translations[tgt] = text
+	}
+	return translations
+}
+
+// passThrough sends text untranslated, based on out, to every recipient
+func (ws *WebSocket) passThrough(groups map[target][]*chat.Client, text string, out Message) {
+	for _, recipients := range groups {
+		for _, recipient := range recipients {
+			msg := out
+			msg.Text = text
+			if err := ws.sendMessage(recipient, msg); err != nil {
+				log.Printf("Error sending message to client %s: %v", recipient.GetName(), err)
+			}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package websocket
+
+import (
+	"log"
+
+	"shabe/server/chat"
+)
+
+// NotifyTranslationStatus tells every connected client whether translation is
+// temporarily unavailable, so they know why messages arrive untranslated. It
+// is meant to be registered with translate.ResilientTranslator.OnStateChange.
+func (ws *WebSocket) NotifyTranslationStatus(degraded bool) {
+	ws.degraded.Store(degraded)
+	for _, room := range ws.roomManager.GetRooms() {
+		room.BroadcastMessage(func(c *chat.Client) error {
+			ws.sendTranslationStatus(c, degraded)
+			return nil
+		})
+	}
+}
+
+// sendTranslationStatus sends the current translation status to a client
+func (ws *WebSocket) sendTranslationStatus(client *chat.Client, degraded bool) {
+	status := StatusOK
+	if degraded {
+		status = StatusDegraded
+	}
+	if err := client.Send(Message{Type: TypeTranslationStatus, Status: status}); err != nil {
+		log.Printf("Error sending translation status to client %s: %v", client.GetName(), err)
+	}
+}
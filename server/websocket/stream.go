@@ -0,0 +1,43 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"shabe/server/chat"
+)
+
+// newMessageID returns a random identifier for a chat message
+func newMessageID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("Error generating message ID: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// deltaSender returns a function that sends a partial translation of out to
+// recipients as a message_delta frame, skipping updates that arrive within
+// DeltaInterval of the previous one. The final message frame always follows,
+// so a skipped update is never the last word. The returned function must not
+// be called concurrently.
+func (ws *WebSocket) deltaSender(recipients []*chat.Client, out Message) func(string) {
+	var last time.Time
+	return func(partial string) {
+		if time.Since(last) < ws.config.DeltaInterval {
+			return
+		}
+		last = time.Now()
+
+		delta := out
+		delta.Type = TypeMessageDelta
+		delta.Text = partial
+		for _, recipient := range recipients {
+			if err := recipient.Send(delta); err != nil {
+				log.Printf("Error sending message delta to client %s: %v", recipient.GetName(), err)
+			}
+		}
+	}
+}
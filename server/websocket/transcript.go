@@ -0,0 +1,30 @@
+package websocket
+
+import (
+	"log"
+	"time"
+
+	"shabe/server/chat"
+	"shabe/server/transcript"
+)
+
+// recordTranscript stores a chat message and its translations if transcripts
+// are enabled
+func (ws *WebSocket) recordTranscript(room *chat.Room, sender *chat.Client, sourceLang, text string, translations map[string]string, timestamp time.Time) {
+	if ws.config.Transcripts == nil {
+		return
+	}
+
+	err := ws.config.Transcripts.Append(transcript.Entry{
+		RoomID:         room.GetID(),
+		SenderName:     sender.GetName(),
+		SenderEmail:    sender.GetEmail(),
+		SourceLanguage: sourceLang,
+		Text:           text,
+		Translations:   translations,
+		Timestamp:      timestamp,
+	})
+	if err != nil {
+		log.Printf("Error recording transcript for room %s: %v", room.GetID(), err)
+	}
+}
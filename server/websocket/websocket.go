@@ -1,36 +1,149 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"shabe/server/auth"
 	"shabe/server/chat"
+	"shabe/server/glossary"
+	"shabe/server/language"
+	"shabe/server/quota"
+	"shabe/server/transcript"
 	"shabe/server/translate"
 
 	"github.com/gorilla/websocket"
 )
 
+// defaultMaxConcurrentTranslations bounds the in-flight translation calls of
+// each room unless configured otherwise
+const defaultMaxConcurrentTranslations = 8
+
 // WebSocket manages WebSocket connections and message handling
 type WebSocket struct {
 	upgrader    websocket.Upgrader
 	roomManager *chat.RoomManager
 	authManager auth.Authenticator
 	translator  translate.Translator
+	config      *Config
+	workers     *workerPool // bounds concurrent translations per room
+	degraded    atomic.Bool // translation is temporarily unavailable
+}
+
+// Config holds the WebSocket handler configuration
+type Config struct {
+	ClientOptions chat.ClientOptions
+	// Transcripts records every chat message; nil disables transcripts
+	Transcripts transcript.Store
+	// ContextTurns is how many recent room messages are passed to translators
+	// that support conversation context; zero disables context-aware translation
+	ContextTurns int
+	// Glossaries holds the org-wide and per-room glossaries applied to
+	// translations; nil disables glossaries
+	Glossaries glossary.Store
+	// Detector identifies the language each message is actually written in;
+	// nil trusts the sender's preferred language
+	Detector translate.LanguageDetector
+	// DetectionThreshold is the confidence below which a detection is ignored
+	// in favour of the sender's preferred language
+	DetectionThreshold float64
+	// TranslationTimeout bounds each translation call; zero means no deadline
+	TranslationTimeout time.Duration
+	// Streaming sends message_delta frames while translations are produced,
+	// at most one per DeltaInterval per language
+	Streaming     bool
+	DeltaInterval time.Duration
+	// MultiTarget translates a message into all recipients' languages with a
+	// single request when the translator supports it and neither streaming
+	// nor conversation context is in use
+	MultiTarget bool
+	// InterimInterval is how often an utterance's interim transcript is
+	// translated while it is being spoken; zero ignores interim messages
+	InterimInterval time.Duration
+	// Quotas limits how much each user and email domain may translate;
+	// nil disables quotas
+	Quotas *quota.Manager
+	// MaxConcurrentTranslations bounds the in-flight translation calls of
+	// each room, including history replays and interim updates; zero uses
+	// the default
+	MaxConcurrentTranslations int
+}
+
+// DefaultConfig returns the configuration used by NewHandler
+func DefaultConfig() *Config {
+	return &Config{
+		ClientOptions:      chat.DefaultClientOptions(),
+		TranslationTimeout: 10 * time.Second,
+		DetectionThreshold: 0.6,
+		DeltaInterval:      100 * time.Millisecond,
+		MultiTarget:        true,
+		InterimInterval:    500 * time.Millisecond,
+
+		MaxConcurrentTranslations: defaultMaxConcurrentTranslations,
+	}
 }
 
+// Message types exchanged over the websocket
+const (
+	TypeMessage            = "message"
+	TypePreferences        = "preferences"
+	TypeJoin               = "join"
+	TypeLeave              = "leave"
+	TypeRoster             = "roster"
+	TypePreferencesChanged = "preferences_changed"
+	TypeTranslationStatus  = "translation_status"
+	TypeMessageDelta       = "message_delta"
+	TypeInterim            = "interim"
+	TypeError              = "error"
+	TypeQuotaExceeded      = "quota_exceeded"
+)
+
+// Translation status values carried by translation_status messages
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+)
+
 // Message represents a websocket message
 type Message struct {
-	Type     string `json:"type"`
+	Type string `json:"type"`
+	// ID identifies a chat message, so message_delta frames can be matched
+	// with the message frame that completes them
+	ID       string `json:"id,omitempty"`
 	Text     string `json:"text,omitempty"`
 	Language string `json:"language,omitempty"`
-	Name     string `json:"name,omitempty"`
+	// SourceLanguage is the detected language a chat message was written in
+	SourceLanguage string        `json:"sourceLanguage,omitempty"`
+	Name           string        `json:"name,omitempty"`
+	ClientID       string        `json:"clientId,omitempty"`
+	Timestamp      int64         `json:"timestamp,omitempty"` // Unix milliseconds
+	History        bool          `json:"history,omitempty"`   // replayed from room history
+	EmailHash      string        `json:"emailHash,omitempty"`
+	Participants   []Participant `json:"participants,omitempty"`
+	Status         string        `json:"status,omitempty"`
+	// Formality is the register a client wants translations in and
+	// RoomFormality the default for clients that chose auto
+	Formality     string `json:"formality,omitempty"`
+	RoomFormality string `json:"roomFormality,omitempty"`
+	// Quota is the quota a quota_exceeded message is about
+	Quota *quota.Exceeded `json:"quota,omitempty"`
 }
 
-// NewHandler creates a new WebSocket handler
+// NewHandler creates a new WebSocket handler with the default configuration
 func NewHandler(roomManager *chat.RoomManager, authManager auth.Authenticator, translator translate.Translator) *WebSocket {
+	return NewHandlerWithConfig(roomManager, authManager, translator, DefaultConfig())
+}
+
+// NewHandlerWithConfig creates a new WebSocket handler
+func NewHandlerWithConfig(roomManager *chat.RoomManager, authManager auth.Authenticator, translator translate.Translator, cfg *Config) *WebSocket {
 	return &WebSocket{
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
@@ -42,6 +155,8 @@ func NewHandler(roomManager *chat.RoomManager, authManager auth.Authenticator, t
 		roomManager: roomManager,
 		authManager: authManager,
 		translator:  translator,
+		config:      cfg,
+		workers:     newWorkerPool(cfg.MaxConcurrentTranslations),
 	}
 }
 
@@ -59,9 +174,16 @@ func (ws *WebSocket) HandleConnection(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Failed to setup client and room: %v", err)
 		return
 	}
-	defer room.RemoveClient(client)
+	defer client.Close()
+	defer ws.leaveRoom(room, client)
+
+	ws.sendRoster(client, room)
+	ws.broadcastPresence(room, TypeJoin, client)
+	if ws.degraded.Load() {
+		ws.sendTranslationStatus(client, true)
+	}
 
-	ws.messageLoop(client, room)
+	ws.messageLoop(client, room, room.GetHistory())
 }
 
 // upgradeConnection upgrades the HTTP connection to WebSocket
@@ -96,58 +218,136 @@ func (ws *WebSocket) setupClientAndRoom(r *http.Request, conn *websocket.Conn) (
 		return nil, nil, fmt.Errorf("failed to get user info: %v", err)
 	}
 
-	client := chat.NewClient(conn, userInfo.Name, userInfo.Email)
-	room := ws.roomManager.GetOrCreateRoom(roomID)
-	room.AddClient(client)
+	client := chat.NewClientWithOptions(conn, userInfo.Name, userInfo.Email, ws.config.ClientOptions)
+	room := ws.roomManager.JoinRoom(roomID, client)
 
 	return client, room, nil
 }
 
-// messageLoop handles the main message processing loop
-func (ws *WebSocket) messageLoop(client *chat.Client, room *chat.Room) {
+// inboxSize is the number of received messages buffered per client while
+// earlier ones are being processed
+const inboxSize = 32
+
+// messageLoop handles the main message processing loop. Messages are
+// processed on a separate goroutine so the connection keeps being read while
+// a translation is in flight; a disconnect closes the client, which cancels
+// any translation done on its behalf.
+func (ws *WebSocket) messageLoop(client *chat.Client, room *chat.Room, backlog []chat.HistoryMessage) {
+	inbox := make(chan []byte, inboxSize)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ws.processMessages(inbox, client, room, backlog)
+	}()
+	defer func() {
+		client.Close()
+		close(inbox)
+		<-done
+	}()
+
 	for {
 		messageType, p, err := client.ReadMessage()
 		if err != nil {
-			log.Printf("Error reading message: %v", err)
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				log.Printf("Client %s missed heartbeat, disconnecting", client.GetName())
+			} else {
+				log.Printf("Error reading message: %v", err)
+			}
 			return
 		}
 
 		if messageType == websocket.TextMessage {
-			if err := ws.handleTextMessage(p, client, room); err != nil {
-				log.Printf("Error handling message: %v", err)
-				continue
-			}
+			inbox <- p
+		}
+	}
+}
+
+// processMessages handles a client's messages in the order they arrived. The
+// backlog of messages sent before the client joined is replayed after its
+// first message, which the extension uses to set the client's language.
+func (ws *WebSocket) processMessages(inbox <-chan []byte, client *chat.Client, room *chat.Room, backlog []chat.HistoryMessage) {
+	interims := newInterimTracker(ws, client, room)
+	defer interims.stop()
+
+	replayed := false
+	for p := range inbox {
+		if err := ws.handleTextMessage(p, client, room, interims); err != nil {
+			log.Printf("Error handling message: %v", err)
+		}
+		if !replayed {
+			replayed = true
+			ws.replayHistory(ws.translationContext(client, room), client, room, backlog)
 		}
 	}
 }
 
 // handleTextMessage processes text messages
-func (ws *WebSocket) handleTextMessage(payload []byte, client *chat.Client, room *chat.Room) error {
+func (ws *WebSocket) handleTextMessage(payload []byte, client *chat.Client, room *chat.Room, interims *interimTracker) error {
 	var msg Message
 	if err := json.Unmarshal(payload, &msg); err != nil {
 		return fmt.Errorf("error unmarshaling message: %v", err)
 	}
 
 	switch msg.Type {
-	case "preferences":
-		return ws.handlePreferences(msg, client)
-	case "message":
+	case TypePreferences:
+		return ws.handlePreferences(msg, client, room)
+	case TypeInterim:
+		return interims.update(msg)
+	case TypeMessage:
+		interims.finish(msg.ID)
 		return ws.handleChatMessage(msg, client, room)
 	default:
 		return fmt.Errorf("unknown message type: %s", msg.Type)
 	}
 }
 
-// handlePreferences updates client preferences
-func (ws *WebSocket) handlePreferences(msg Message, client *chat.Client) error {
+// handlePreferences updates client preferences and tells the rest of the
+// room if its name or language changed. An unknown language or formality is
+// answered with an error message and leaves all preferences unchanged.
+func (ws *WebSocket) handlePreferences(msg Message, client *chat.Client, room *chat.Room) error {
+	var lang string
+	var formality, roomFormality translate.Formality
+	var err error
 	if msg.Language != "" {
-		client.SetLanguage(msg.Language)
+		if lang, err = language.Parse(msg.Language); err != nil {
+			return ws.sendMessage(client, Message{Type: TypeError, Text: err.Error(), Language: msg.Language})
+		}
+	}
+	if msg.Formality != "" {
+		if formality, err = translate.ParseFormality(msg.Formality); err != nil {
+			return ws.sendMessage(client, Message{Type: TypeError, Text: err.Error(), Formality: msg.Formality})
+		}
 	}
-	if msg.Name != "" {
+	if msg.RoomFormality != "" {
+		if roomFormality, err = translate.ParseFormality(msg.RoomFormality); err != nil {
+			return ws.sendMessage(client, Message{Type: TypeError, Text: err.Error(), RoomFormality: msg.RoomFormality})
+		}
+	}
+
+	changed := false
+	if lang != "" && lang != client.GetLanguage() {
+		client.SetLanguage(lang)
+		changed = true
+	}
+	if msg.Name != "" && msg.Name != client.GetName() {
 		client.SetName(msg.Name)
+		changed = true
+	}
+	// Formality only affects what the client itself receives
+	if formality != "" {
+		client.SetFormality(string(formality))
+	}
+	if roomFormality != "" {
+		room.SetFormality(string(roomFormality))
+		log.Printf("Client %s set room %s formality to %s", client.GetName(), room.GetID(), roomFormality)
+	}
+	log.Printf("Client %s set preferences: language=%s, name=%s, formality=%s",
+		client.GetName(), client.GetLanguage(), client.GetName(), client.GetFormality())
+
+	if changed {
+		ws.broadcastPresence(room, TypePreferencesChanged, client)
 	}
-	log.Printf("Client %s set preferences: language=%s, name=%s",
-		client.GetName(), client.GetLanguage(), client.GetName())
 	return nil
 }
 
@@ -159,38 +359,146 @@ func (ws *WebSocket) handleChatMessage(msg Message, client *chat.Client, room *c
 
 	log.Printf("Got Message: %s from %s", msg.Text, msg.Name)
 
-	room.BroadcastMessage(func(c *chat.Client) error {
-		// Skip sending message back to sender
-		if c == client {
-			return nil
-		}
-		return ws.sendTranslatedMessage(c, msg.Text, client)
+	now := time.Now()
+	recent := ws.recentContext(room)
+	ctx := ws.translationContext(client, room)
+	// Once the speaker is over quota, messages are passed on untranslated
+	// without asking a model to detect their language either
+	allowed := ws.withinQuota(client, true)
+	fromLang := client.GetLanguage()
+	if allowed {
+		fromLang = ws.detectLanguage(ctx, client, msg.Text)
+	}
+	// A final transcript keeps its utterance ID so it replaces the interim
+	// updates recipients have shown
+	id := newMessageID()
+	if msg.ID != "" && len(msg.ID) <= maxUtteranceIDLength {
+		id = utteranceID(client, msg.ID)
+	}
+	out := Message{
+		Type:           TypeMessage,
+		ID:             id,
+		Name:           client.GetName(),
+		SourceLanguage: fromLang,
+	}
+	groups := groupByTarget(room, client)
+	var translations map[string]string
+	if allowed {
+		translations = ws.fanOut(ctx, groups, msg.Text, out, recent)
+	} else {
+		ws.passThrough(groups, msg.Text, out)
+	}
+
+	room.AddToHistory(chat.HistoryMessage{
+		SenderID:     client.GetID(),
+		SenderName:   client.GetName(),
+		Language:     fromLang,
+		Text:         msg.Text,
+		Translations: translations,
+		Timestamp:    now,
 	})
+	ws.recordTranscript(room, client, fromLang, msg.Text, translations, now)
 	return nil
 }
 
-// sendMessage sends a message to a client
-func (ws *WebSocket) sendMessage(client *chat.Client, text, name string) error {
-	log.Printf("Send Message: %s to %s", text, client.GetName())
+// fanOut translates text once per target language and formality, running the
+// translations concurrently on a bounded worker pool, and queues each result,
+// based on out, for every recipient in that group as soon as it is ready.
+// With streaming enabled recipients also get message_delta frames while the
+// translation is produced. Without streaming or conversation context, a
+// translator with multi-target support translates into every language in one
+// request instead. Translations are abandoned once ctx is done. It returns
+// the text delivered for each target language other than the message's own.
+func (ws *WebSocket) fanOut(ctx context.Context, groups map[target][]*chat.Client, text string, out Message, recent []chat.HistoryMessage) map[string]string {
+	fromLang := out.SourceLanguage
 
-	return client.WriteJSON(Message{
-		Type: "message",
-		Text: text,
-		Name: name,
-	})
+	if !ws.config.Streaming && len(recent) == 0 {
+		if all, ok := ws.translateMulti(ctx, groups, text, fromLang); ok {
+			translations := make(map[string]string)
+			for tgt, recipients := range groups {
+				recordTranslation(translations, tgt, fromLang, all[tgt])
+				for _, recipient := range recipients {
+					msg := out
+					msg.Text = all[tgt]
+					if err := ws.sendMessage(recipient, msg); err != nil {
+						log.Printf("Error sending message to client %s: %v", recipient.GetName(), err)
+					}
+				}
+			}
+			return translations
+		}
+	}
+
+	translations := make(map[string]string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for tgt, recipients := range groups {
+		wg.Add(1)
+		release := ws.workers.acquire(ctx)
+		go func(tgt target, recipients []*chat.Client) {
+			defer wg.Done()
+			defer release()
+
+			var onDelta func(string)
+			if ws.config.Streaming {
+				onDelta = ws.deltaSender(recipients, out)
+			}
+			translatedText := ws.translateText(tgt.context(ctx), text, fromLang, tgt.lang, recent, onDelta)
+			mu.Lock()
+			recordTranslation(translations, tgt, fromLang, translatedText)
+			mu.Unlock()
+			for _, recipient := range recipients {
+				msg := out
+				msg.Text = translatedText
+				if err := ws.sendMessage(recipient, msg); err != nil {
+					log.Printf("Error sending message to client %s: %v", recipient.GetName(), err)
+				}
+			}
+		}(tgt, recipients)
+	}
+	wg.Wait()
+	return translations
 }
 
-// sendTranslatedMessage translates and sends a message to a client
-func (ws *WebSocket) sendTranslatedMessage(recipient *chat.Client, text string, sender *chat.Client) error {
-	translatedText := text
-	if recipient.GetLanguage() != sender.GetLanguage() {
-		translated, err := ws.translator.Translate(text, sender.GetLanguage(), recipient.GetLanguage())
-		if err != nil {
-			log.Printf("Translation error: %v", err)
-		} else {
-			translatedText = translated
-		}
+// sendMessage queues a message for delivery to a client
+func (ws *WebSocket) sendMessage(client *chat.Client, msg Message) error {
+	log.Printf("Send Message: %s to %s", msg.Text, client.GetName())
+	return client.Send(msg)
+}
+
+// translateText translates text into the target language, falling back to the
+// original text if translation fails or times out. Translators that support
+// conversation context receive the given recent messages. If onDelta is set
+// and the translator supports streaming, it receives the translation so far
+// as it grows.
+func (ws *WebSocket) translateText(ctx context.Context, text, fromLang, toLang string, recent []chat.HistoryMessage, onDelta func(string)) string {
+	if sameLanguage(fromLang, toLang) {
+		return text
+	}
+
+	if ws.config.TranslationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ws.config.TranslationTimeout)
+		defer cancel()
 	}
 
-	return ws.sendMessage(recipient, translatedText, sender.GetName())
+	var translated string
+	var err error
+	if st, ok := ws.translator.(translate.StreamingTranslator); ok && onDelta != nil {
+		var turns []translate.Turn
+		if len(recent) > 0 {
+			turns = conversationTurns(recent, toLang)
+		}
+		translated, err = st.TranslateStream(ctx, turns, text, fromLang, toLang, onDelta)
+	} else if ct, ok := ws.translator.(translate.ConversationTranslator); ok && len(recent) > 0 {
+		translated, err = ct.TranslateConversation(ctx, conversationTurns(recent, toLang), text, fromLang, toLang)
+	} else {
+		translated, err = ws.translator.Translate(ctx, text, fromLang, toLang)
+	}
+	if err != nil {
+		log.Printf("Translation error: %v", err)
+		return text
+	}
+	ws.chargeQuota(ctx, text, 1)
+	return translated
 }
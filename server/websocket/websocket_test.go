@@ -1,16 +1,25 @@
 package websocket
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"shabe/server/auth"
 	"shabe/server/chat"
+	"shabe/server/glossary"
+	"shabe/server/quota"
+	"shabe/server/transcript"
 	"shabe/server/translate"
 
 	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
 )
 
 type mockAuth struct {
@@ -28,7 +37,9 @@ func (m *mockAuth) HandleAuthVerify(w http.ResponseWriter, r *http.Request)   {}
 func (m *mockAuth) GetAuthURL() string                                        { return "" }
 func (m *mockAuth) ExchangeCode(code string) (*auth.UserInfo, string, error)  { return nil, "", nil }
 
-func setupTest() (*WebSocket, *httptest.Server) {
+// setupTest starts a server whose clients all sign in as Test User. A nil
+// translator uses the mock translator and a nil cfg the default configuration.
+func setupTest(translator translate.Translator, cfg *Config) (*WebSocket, *httptest.Server) {
 	roomManager := chat.NewRoomManager()
 	authManager := &mockAuth{
 		userInfo: &auth.UserInfo{
@@ -36,59 +47,67 @@ func setupTest() (*WebSocket, *httptest.Server) {
 			Email: "test@example.com",
 		},
 	}
-	translator := translate.NewMockTranslator()
-	ws := NewHandler(roomManager, authManager, translator)
+	if translator == nil {
+		translator = translate.NewMockTranslator()
+	}
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	ws := NewHandlerWithConfig(roomManager, authManager, translator, cfg)
 
 	server := httptest.NewServer(http.HandlerFunc(ws.HandleConnection))
 	return ws, server
 }
 
+// dialURL returns the websocket URL of server with the given query
+func dialURL(serverURL, query string) string {
+	u, _ := url.Parse(serverURL)
+	u.Scheme = "ws"
+	u.RawQuery = query
+	return u.String()
+}
+
 func TestWebSocket_UpgradeConnection(t *testing.T) {
-	_, server := setupTest()
+	_, server := setupTest(nil, nil)
 	defer server.Close()
 
-	// Convert http URL to ws URL
-	u, _ := url.Parse(server.URL)
-	u.Scheme = "ws"
-	u.RawQuery = "token=valid-token&roomId=test-room"
+	u := dialURL(server.URL, "token=valid-token&roomId=test-room")
 
 	// Test successful connection
 	t.Run("successful connection", func(t *testing.T) {
-		c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+		c, _, err := websocket.DefaultDialer.Dial(u, nil)
 		assert.NoError(t, err)
 		defer c.Close()
 	})
 
 	// Test missing room ID
 	t.Run("missing room ID", func(t *testing.T) {
-		u.RawQuery = "token=valid-token"
-		_, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+		u = dialURL(server.URL, "token=valid-token")
+		_, _, err := websocket.DefaultDialer.Dial(u, nil)
 		assert.Error(t, err)
 	})
 
 	// Test missing token
 	t.Run("missing token", func(t *testing.T) {
-		u.RawQuery = "roomId=test-room"
-		_, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+		u = dialURL(server.URL, "roomId=test-room")
+		_, _, err := websocket.DefaultDialer.Dial(u, nil)
 		assert.Error(t, err)
 	})
 }
 
 func TestWebSocket_MessageHandling(t *testing.T) {
-	_, server := setupTest()
+	_, server := setupTest(nil, nil)
 	defer server.Close()
 
 	// Setup WebSocket connection
-	u, _ := url.Parse(server.URL)
-	u.Scheme = "ws"
-	u.RawQuery = "token=valid-token&roomId=test-room"
+	u := dialURL(server.URL, "token=valid-token&roomId=test-room")
 
 	// Connect two clients
-	c1, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	c1, _, err := websocket.DefaultDialer.Dial(u, nil)
 	assert.NoError(t, err)
 	defer c1.Close()
 
-	c2, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	c2, _, err := websocket.DefaultDialer.Dial(u, nil)
 	assert.NoError(t, err)
 	defer c2.Close()
 
@@ -114,9 +133,7 @@ func TestWebSocket_MessageHandling(t *testing.T) {
 		assert.NoError(t, err)
 
 		// Read message from client 2
-		var received Message
-		err = c2.ReadJSON(&received)
-		assert.NoError(t, err)
+		received := readMessageOfType(t, c2, TypeMessage)
 		assert.Equal(t, "message", received.Type)
 		assert.Equal(t, "Hello, World!", received.Text)
 	})
@@ -136,11 +153,754 @@ func TestWebSocket_ErrorHandling(t *testing.T) {
 
 	// Test auth failure
 	t.Run("auth failure", func(t *testing.T) {
-		u, _ := url.Parse(server.URL)
-		u.Scheme = "ws"
-		u.RawQuery = "token=invalid-token&roomId=test-room"
+		u := dialURL(server.URL, "token=invalid-token&roomId=test-room")
 
-		_, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+		_, _, err := websocket.DefaultDialer.Dial(u, nil)
 		assert.Error(t, err)
 	})
 }
+
+// countingTranslator records how many times each language pair is translated
+type countingTranslator struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (t *countingTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.calls[fromLang+"->"+toLang]++
+	return "[" + toLang + "] " + text, nil
+}
+
+func (t *countingTranslator) count(pair string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.calls[pair]
+}
+
+// readMessageOfType reads from c until a message of the given type arrives,
+// skipping presence and other unrelated frames
+func readMessageOfType(t *testing.T, c *websocket.Conn, msgType string) Message {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	defer c.SetReadDeadline(time.Time{})
+	for {
+		var msg Message
+		if err := c.ReadJSON(&msg); err != nil {
+			t.Fatalf("waiting for %s message: %v", msgType, err)
+		}
+		if msg.Type == msgType {
+			return msg
+		}
+	}
+}
+
+// connectWithLanguages dials one client per language into test-room and waits
+// until every client's preferences have been applied
+func connectWithLanguages(t *testing.T, roomManager *chat.RoomManager, serverURL string, languages []string) []*websocket.Conn {
+	return connectToRoom(t, roomManager, serverURL, "test-room", languages)
+}
+
+// connectToRoom dials one client per language into roomID and waits until
+// every client's preferences have been applied
+func connectToRoom(t *testing.T, roomManager *chat.RoomManager, serverURL, roomID string, languages []string) []*websocket.Conn {
+	u := dialURL(serverURL, url.Values{"token": {"valid-token"}, "roomId": {roomID}}.Encode())
+
+	conns := make([]*websocket.Conn, len(languages))
+	expected := make(map[string]int)
+	for i, lang := range languages {
+		c, _, err := websocket.DefaultDialer.Dial(u, nil)
+		assert.NoError(t, err)
+		t.Cleanup(func() { c.Close() })
+		assert.NoError(t, c.WriteJSON(Message{Type: "preferences", Language: lang}))
+		conns[i] = c
+		expected[lang]++
+	}
+
+	assert.Eventually(t, func() bool {
+		room := roomManager.GetRoom(roomID)
+		if room == nil || room.GetClientCount() != len(languages) {
+			return false
+		}
+		counts := make(map[string]int)
+		for _, c := range room.GetClients() {
+			counts[c.GetLanguage()]++
+		}
+		return assert.ObjectsAreEqual(expected, counts)
+	}, time.Second, 10*time.Millisecond)
+
+	return conns
+}
+
+func TestWebSocket_TranslateOncePerLanguage(t *testing.T) {
+	translator := &countingTranslator{calls: make(map[string]int)}
+	ws, server := setupTest(translator, nil)
+
+	defer server.Close()
+
+	// Connect a sender and three listeners, two of which read Japanese
+	conns := connectWithLanguages(t, ws.roomManager, server.URL, []string{"en", "ja", "ja", "es"})
+
+	assert.NoError(t, conns[0].WriteJSON(Message{Type: "message", Text: "hello"}))
+
+	expected := []string{"", "[ja] hello", "[ja] hello", "[es] hello"}
+	for i := 1; i < len(conns); i++ {
+		received := readMessageOfType(t, conns[i], TypeMessage)
+		assert.Equal(t, expected[i], received.Text)
+	}
+
+	assert.Equal(t, 1, translator.count("en->ja"))
+	assert.Equal(t, 1, translator.count("en->es"))
+}
+
+// blockingTranslator blocks translations into one language until released
+type blockingTranslator struct {
+	blockLang string
+	release   chan struct{}
+	blocked   atomic.Int32 // translations currently waiting for release
+}
+
+func (t *blockingTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	if toLang == t.blockLang {
+		t.blocked.Add(1)
+		defer t.blocked.Add(-1)
+		<-t.release
+	}
+	return "[" + toLang + "] " + text, nil
+}
+
+func TestWebSocket_SlowTranslationDoesNotBlockOtherLanguages(t *testing.T) {
+	translator := &blockingTranslator{blockLang: "ja", release: make(chan struct{})}
+	ws, server := setupTest(translator, nil)
+
+	defer server.Close()
+
+	conns := connectWithLanguages(t, ws.roomManager, server.URL, []string{"en", "ja", "es"})
+
+	assert.NoError(t, conns[0].WriteJSON(Message{Type: "message", Text: "hello"}))
+
+	// The Spanish listener receives its translation while Japanese is stalled
+	received := readMessageOfType(t, conns[2], TypeMessage)
+	assert.Equal(t, "[es] hello", received.Text)
+
+	close(translator.release)
+	received = readMessageOfType(t, conns[1], TypeMessage)
+	assert.Equal(t, "[ja] hello", received.Text)
+}
+
+func TestWebSocket_SlowRoomDoesNotBlockOtherRooms(t *testing.T) {
+	translator := &blockingTranslator{blockLang: "ja", release: make(chan struct{})}
+	cfg := DefaultConfig()
+	cfg.MaxConcurrentTranslations = 1
+	ws, server := setupTest(translator, cfg)
+
+	defer server.Close()
+	defer close(translator.release)
+
+	slow := connectToRoom(t, ws.roomManager, server.URL, "slow-room", []string{"en", "ja"})
+	other := connectToRoom(t, ws.roomManager, server.URL, "other-room", []string{"en", "es"})
+
+	// The slow room uses up its only worker
+	assert.NoError(t, slow[0].WriteJSON(Message{Type: "message", Text: "hello"}))
+	assert.Eventually(t, func() bool { return translator.blocked.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	// The other room still gets its translations
+	assert.NoError(t, other[0].WriteJSON(Message{Type: "message", Text: "hola"}))
+	received := readMessageOfType(t, other[1], TypeMessage)
+	assert.Equal(t, "[es] hola", received.Text)
+}
+
+func TestWebSocket_Heartbeat(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ClientOptions.PingInterval = 20 * time.Millisecond
+	cfg.ClientOptions.PongWait = 100 * time.Millisecond
+	ws, server := setupTest(nil, cfg)
+
+	defer server.Close()
+
+	u := dialURL(server.URL, "token=valid-token&roomId=test-room")
+
+	// A peer that keeps reading answers pings and stays in the room
+	alive, _, err := websocket.DefaultDialer.Dial(u, nil)
+	assert.NoError(t, err)
+	defer alive.Close()
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// A peer that never reads never answers pings and is reaped
+	dead, _, err := websocket.DefaultDialer.Dial(u, nil)
+	assert.NoError(t, err)
+	defer dead.Close()
+
+	assert.Eventually(t, func() bool {
+		room := ws.roomManager.GetRoom("test-room")
+		return room != nil && room.GetClientCount() == 2
+	}, time.Second, 5*time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		return ws.roomManager.GetRoom("test-room").GetClientCount() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// The responsive peer survives several heartbeat windows
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, 1, ws.roomManager.GetRoom("test-room").GetClientCount())
+}
+
+func TestWebSocket_HeartbeatDisabled(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ClientOptions.PingInterval = 0
+	cfg.ClientOptions.PongWait = 50 * time.Millisecond
+	ws, server := setupTest(nil, cfg)
+
+	defer server.Close()
+
+	// Without pings a peer that only listens has nothing to answer, so it
+	// must not be taken for dead
+	connectWithLanguages(t, ws.roomManager, server.URL, []string{"en"})
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, 1, ws.roomManager.GetRoom("test-room").GetClientCount())
+}
+
+func TestWebSocket_Presence(t *testing.T) {
+	ws, server := setupTest(nil, nil)
+	defer server.Close()
+
+	u := dialURL(server.URL, "token=valid-token&roomId=test-room")
+
+	c1, _, err := websocket.DefaultDialer.Dial(u, nil)
+	assert.NoError(t, err)
+	defer c1.Close()
+	roster1 := readMessageOfType(t, c1, TypeRoster)
+	assert.Len(t, roster1.Participants, 1)
+	assert.Equal(t, roster1.ClientID, roster1.Participants[0].ClientID)
+
+	c2, _, err := websocket.DefaultDialer.Dial(u, nil)
+	assert.NoError(t, err)
+	defer c2.Close()
+
+	// The newcomer gets the full roster and everyone else a join event
+	roster2 := readMessageOfType(t, c2, TypeRoster)
+	assert.Len(t, roster2.Participants, 2)
+	for _, p := range roster2.Participants {
+		assert.Equal(t, "Test User", p.Name)
+		assert.Equal(t, "en", p.Language)
+		assert.NotEmpty(t, p.EmailHash)
+		assert.NotContains(t, p.EmailHash, "@")
+	}
+
+	join := readMessageOfType(t, c1, TypeJoin)
+	assert.Equal(t, roster2.ClientID, join.ClientID)
+	assert.Equal(t, "Test User", join.Name)
+
+	// Preference updates are announced to the rest of the room
+	assert.NoError(t, c2.WriteJSON(Message{Type: TypePreferences, Language: "ja", Name: "Taro"}))
+	changed := readMessageOfType(t, c1, TypePreferencesChanged)
+	assert.Equal(t, roster2.ClientID, changed.ClientID)
+	assert.Equal(t, "ja", changed.Language)
+	assert.Equal(t, "Taro", changed.Name)
+
+	c2.Close()
+	leave := readMessageOfType(t, c1, TypeLeave)
+	assert.Equal(t, roster2.ClientID, leave.ClientID)
+	assert.Equal(t, 1, ws.roomManager.GetRoom("test-room").GetClientCount())
+}
+
+func TestWebSocket_HistoryReplay(t *testing.T) {
+	_, server := setupTest(nil, nil)
+	defer server.Close()
+
+	u := dialURL(server.URL, "token=valid-token&roomId=test-room")
+
+	speaker, _, err := websocket.DefaultDialer.Dial(u, nil)
+	assert.NoError(t, err)
+	defer speaker.Close()
+	readMessageOfType(t, speaker, TypeRoster)
+	assert.NoError(t, speaker.WriteJSON(Message{Type: TypeMessage, Text: "hello"}))
+	assert.NoError(t, speaker.WriteJSON(Message{Type: TypeMessage, Text: "how are you"}))
+
+	// Give the server time to record both messages before the late joiner arrives
+	time.Sleep(50 * time.Millisecond)
+
+	late, _, err := websocket.DefaultDialer.Dial(u, nil)
+	assert.NoError(t, err)
+	defer late.Close()
+	assert.NoError(t, late.WriteJSON(Message{Type: TypePreferences, Language: "ja"}))
+
+	first := readMessageOfType(t, late, TypeMessage)
+	assert.True(t, first.History)
+	assert.Equal(t, "こんにちは", first.Text)
+	assert.NotZero(t, first.Timestamp)
+
+	second := readMessageOfType(t, late, TypeMessage)
+	assert.True(t, second.History)
+	assert.Equal(t, "お元気ですか？", second.Text)
+}
+
+func TestWebSocket_RecordsTranscript(t *testing.T) {
+	store := transcript.NewMemoryStore()
+	cfg := DefaultConfig()
+	cfg.Transcripts = store
+	ws, server := setupTest(nil, cfg)
+
+	defer server.Close()
+
+	conns := connectWithLanguages(t, ws.roomManager, server.URL, []string{"en", "ja", "en"})
+	assert.NoError(t, conns[0].WriteJSON(Message{Type: TypeMessage, Text: "hello"}))
+	readMessageOfType(t, conns[1], TypeMessage)
+
+	var entries []transcript.Entry
+	assert.Eventually(t, func() bool {
+		entries, _ = store.List("test-room")
+		return len(entries) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	entry := entries[0]
+	assert.Equal(t, "test-room", entry.RoomID)
+	assert.Equal(t, "Test User", entry.SenderName)
+	assert.Equal(t, "test@example.com", entry.SenderEmail)
+	assert.Equal(t, "en", entry.SourceLanguage)
+	assert.Equal(t, "hello", entry.Text)
+	assert.Equal(t, map[string]string{"ja": "こんにちは"}, entry.Translations)
+	assert.False(t, entry.Timestamp.IsZero())
+}
+
+// conversationTranslator records the context passed with each translation
+type conversationTranslator struct {
+	mu    sync.Mutex
+	turns [][]translate.Turn
+}
+
+func (t *conversationTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	return t.TranslateConversation(ctx, nil, text, fromLang, toLang)
+}
+
+func (t *conversationTranslator) TranslateConversation(ctx context.Context, turns []translate.Turn, text, fromLang, toLang string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.turns = append(t.turns, turns)
+	return "[" + toLang + "] " + text, nil
+}
+
+func (t *conversationTranslator) calls() [][]translate.Turn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([][]translate.Turn(nil), t.turns...)
+}
+
+func TestWebSocket_ConversationContext(t *testing.T) {
+	translator := &conversationTranslator{}
+	cfg := DefaultConfig()
+	cfg.ContextTurns = 2
+	ws, server := setupTest(translator, cfg)
+
+	defer server.Close()
+
+	conns := connectWithLanguages(t, ws.roomManager, server.URL, []string{"en", "ja"})
+	for _, text := range []string{"one", "two", "three"} {
+		assert.NoError(t, conns[0].WriteJSON(Message{Type: TypeMessage, Text: text}))
+		readMessageOfType(t, conns[1], TypeMessage)
+	}
+
+	calls := translator.calls()
+	assert.Len(t, calls, 3)
+	assert.Empty(t, calls[0])
+
+	// Only the configured number of turns is sent, with earlier translations
+	assert.Equal(t, []translate.Turn{
+		{Speaker: "Test User", Language: "en", Text: "one", Translation: "[ja] one"},
+		{Speaker: "Test User", Language: "en", Text: "two", Translation: "[ja] two"},
+	}, calls[2])
+}
+
+// waitingTranslator blocks until its context is done and reports why
+type waitingTranslator struct {
+	errs chan error
+}
+
+func (t *waitingTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	<-ctx.Done()
+	t.errs <- ctx.Err()
+	return "", ctx.Err()
+}
+
+func TestWebSocket_TranslationCancellation(t *testing.T) {
+	newServer := func(timeout time.Duration) (*WebSocket, *waitingTranslator, *httptest.Server) {
+		translator := &waitingTranslator{errs: make(chan error, 1)}
+		cfg := DefaultConfig()
+		cfg.TranslationTimeout = timeout
+		ws, server := setupTest(translator, cfg)
+		return ws, translator, server
+	}
+
+	t.Run("deadline falls back to original text", func(t *testing.T) {
+		ws, translator, server := newServer(50 * time.Millisecond)
+		defer server.Close()
+
+		conns := connectWithLanguages(t, ws.roomManager, server.URL, []string{"en", "ja"})
+		assert.NoError(t, conns[0].WriteJSON(Message{Type: TypeMessage, Text: "hello"}))
+
+		assert.ErrorIs(t, <-translator.errs, context.DeadlineExceeded)
+		received := readMessageOfType(t, conns[1], TypeMessage)
+		assert.Equal(t, "hello", received.Text)
+	})
+
+	t.Run("sender disconnect cancels translation", func(t *testing.T) {
+		ws, translator, server := newServer(0)
+		defer server.Close()
+
+		conns := connectWithLanguages(t, ws.roomManager, server.URL, []string{"en", "ja"})
+		assert.NoError(t, conns[0].WriteJSON(Message{Type: TypeMessage, Text: "hello"}))
+		time.Sleep(50 * time.Millisecond)
+		conns[0].Close()
+
+		select {
+		case err := <-translator.errs:
+			assert.ErrorIs(t, err, context.Canceled)
+		case <-time.After(time.Second):
+			t.Fatal("translation was not cancelled")
+		}
+	})
+}
+
+func TestWebSocket_TranslationStatus(t *testing.T) {
+	ws, server := setupTest(nil, nil)
+	defer server.Close()
+
+	conns := connectWithLanguages(t, ws.roomManager, server.URL, []string{"en"})
+
+	ws.NotifyTranslationStatus(true)
+	assert.Equal(t, StatusDegraded, readMessageOfType(t, conns[0], TypeTranslationStatus).Status)
+
+	// Clients joining while degraded are told straight away
+	u := dialURL(server.URL, "token=valid-token&roomId=test-room")
+	late, _, err := websocket.DefaultDialer.Dial(u, nil)
+	assert.NoError(t, err)
+	defer late.Close()
+	assert.Equal(t, StatusDegraded, readMessageOfType(t, late, TypeTranslationStatus).Status)
+
+	ws.NotifyTranslationStatus(false)
+	assert.Equal(t, StatusOK, readMessageOfType(t, conns[0], TypeTranslationStatus).Status)
+	assert.Equal(t, StatusOK, readMessageOfType(t, late, TypeTranslationStatus).Status)
+}
+
+// glossaryTranslator replies with the do-not-translate terms it was given
+type glossaryTranslator struct{}
+
+func (glossaryTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	return strings.Join(glossary.FromContext(ctx).DoNotTranslate, ","), nil
+}
+
+func TestWebSocket_Glossary(t *testing.T) {
+	glossaries := glossary.NewMemoryStore()
+	glossaries.Put(glossary.Org, glossary.Glossary{DoNotTranslate: []string{"Kubernetes"}})
+	glossaries.Put("test-room", glossary.Glossary{DoNotTranslate: []string{"Alice"}})
+	glossaries.Put("other-room", glossary.Glossary{DoNotTranslate: []string{"Bob"}})
+
+	cfg := DefaultConfig()
+	cfg.Glossaries = glossaries
+	ws, server := setupTest(glossaryTranslator{}, cfg)
+	defer server.Close()
+
+	conns := connectWithLanguages(t, ws.roomManager, server.URL, []string{"en", "ja"})
+	assert.NoError(t, conns[0].WriteJSON(Message{Type: TypeMessage, Text: "hello"}))
+	assert.Equal(t, "Kubernetes,Alice", readMessageOfType(t, conns[1], TypeMessage).Text)
+}
+
+// fixedDetector detects every message as the same language
+type fixedDetector struct {
+	lang       string
+	confidence float64
+}
+
+func (d fixedDetector) DetectLanguage(ctx context.Context, text string) (string, float64, error) {
+	return d.lang, d.confidence, nil
+}
+
+func TestWebSocket_LanguageDetection(t *testing.T) {
+	newServer := func(detector translate.LanguageDetector) (*WebSocket, *countingTranslator, *httptest.Server) {
+		translator := &countingTranslator{calls: make(map[string]int)}
+		cfg := DefaultConfig()
+		cfg.Detector = detector
+		ws, server := setupTest(translator, cfg)
+		return ws, translator, server
+	}
+
+	t.Run("detected language is the source", func(t *testing.T) {
+		ws, translator, server := newServer(fixedDetector{lang: "ja", confidence: 0.9})
+		defer server.Close()
+
+		conns := connectWithLanguages(t, ws.roomManager, server.URL, []string{"en", "en", "ja"})
+		assert.NoError(t, conns[0].WriteJSON(Message{Type: TypeMessage, Text: "こんにちは"}))
+
+		english := readMessageOfType(t, conns[1], TypeMessage)
+		assert.Equal(t, "[en] こんにちは", english.Text)
+		assert.Equal(t, "ja", english.SourceLanguage)
+
+		japanese := readMessageOfType(t, conns[2], TypeMessage)
+		assert.Equal(t, "こんにちは", japanese.Text)
+		assert.Equal(t, "ja", japanese.SourceLanguage)
+		assert.Equal(t, 1, translator.count("ja->en"))
+		assert.Equal(t, 0, translator.count("en->ja"))
+	})
+
+	t.Run("script-only guesses keep a preference written in the script", func(t *testing.T) {
+		for _, tt := range []struct{ preferred, text string }{
+			{"fa", "سلام به همه، جلسه را شروع کنیم"},
+			{"bg", "Здравейте, да започваме срещата"},
+			{"ja", "会議資料共有"},
+			{"mr", "नमस्कार, आपण बैठक सुरू करूया"},
+			{"zh-Hant", "我們開始開會吧"},
+		} {
+			ws, _, server := newServer(translate.NewNgramDetector())
+			conns := connectWithLanguages(t, ws.roomManager, server.URL, []string{tt.preferred, "en"})
+			assert.NoError(t, conns[0].WriteJSON(Message{Type: TypeMessage, Text: tt.text}))
+			assert.Equal(t, tt.preferred, readMessageOfType(t, conns[1], TypeMessage).SourceLanguage, tt.preferred)
+			server.Close()
+		}
+
+		// Other languages are still detected
+		ws, _, server := newServer(translate.NewNgramDetector())
+		defer server.Close()
+		conns := connectWithLanguages(t, ws.roomManager, server.URL, []string{"en", "ja"})
+		assert.NoError(t, conns[0].WriteJSON(Message{Type: TypeMessage, Text: "Привет всем"}))
+		assert.Equal(t, "ru", readMessageOfType(t, conns[1], TypeMessage).SourceLanguage)
+	})
+
+	t.Run("unsure detections are ignored", func(t *testing.T) {
+		ws, translator, server := newServer(fixedDetector{lang: "ja", confidence: 0.3})
+		defer server.Close()
+
+		conns := connectWithLanguages(t, ws.roomManager, server.URL, []string{"en", "ja"})
+		assert.NoError(t, conns[0].WriteJSON(Message{Type: TypeMessage, Text: "ok"}))
+
+		received := readMessageOfType(t, conns[1], TypeMessage)
+		assert.Equal(t, "[ja] ok", received.Text)
+		assert.Equal(t, "en", received.SourceLanguage)
+		assert.Equal(t, 1, translator.count("en->ja"))
+	})
+}
+
+func TestSameLanguage(t *testing.T) {
+	assert.True(t, sameLanguage("en", "en"))
+	assert.True(t, sameLanguage("en", "EN-us"))
+	assert.True(t, sameLanguage("pt-BR", "pt-br"))
+	assert.False(t, sameLanguage("zh-Hans", "zh-Hant"))
+	assert.False(t, sameLanguage("zh", "zh-Hant"))
+	assert.False(t, sameLanguage("zh-TW", "zh"))
+	assert.True(t, sameLanguage("zh", "zh-CN"))
+	assert.True(t, sameLanguage("zh-Hant", "zh-Hant"))
+	assert.False(t, sameLanguage("en", "ja"))
+}
+
+// streamingTranslator streams a translation one word at a time
+type streamingTranslator struct{}
+
+func (streamingTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	return "[" + toLang + "] " + text, nil
+}
+
+func (streamingTranslator) TranslateStream(ctx context.Context, turns []translate.Turn, text, fromLang, toLang string, onDelta func(string)) (string, error) {
+	translated := "[" + toLang + "]"
+	for _, word := range strings.Fields(text) {
+		translated += " " + word
+		onDelta(translated)
+	}
+	return translated, nil
+}
+
+func TestWebSocket_Streaming(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Streaming = true
+	cfg.DeltaInterval = 0
+	ws, server := setupTest(streamingTranslator{}, cfg)
+	defer server.Close()
+
+	conns := connectWithLanguages(t, ws.roomManager, server.URL, []string{"en", "ja"})
+	assert.NoError(t, conns[0].WriteJSON(Message{Type: TypeMessage, Text: "good morning"}))
+
+	first := readMessageOfType(t, conns[1], TypeMessageDelta)
+	assert.Equal(t, "[ja] good", first.Text)
+	assert.NotEmpty(t, first.ID)
+	second := readMessageOfType(t, conns[1], TypeMessageDelta)
+	assert.Equal(t, "[ja] good morning", second.Text)
+	assert.Equal(t, first.ID, second.ID)
+
+	final := readMessageOfType(t, conns[1], TypeMessage)
+	assert.Equal(t, "[ja] good morning", final.Text)
+	assert.Equal(t, first.ID, final.ID)
+}
+
+func TestWebSocket_Interim(t *testing.T) {
+	translator := &countingTranslator{calls: make(map[string]int)}
+	cfg := DefaultConfig()
+	cfg.InterimInterval = 100 * time.Millisecond
+	ws, server := setupTest(translator, cfg)
+	defer server.Close()
+
+	conns := connectWithLanguages(t, ws.roomManager, server.URL, []string{"en", "ja"})
+
+	// A burst of interim transcripts is translated once, with the latest text
+	for _, text := range []string{"good", "good morning", "good morning every"} {
+		assert.NoError(t, conns[0].WriteJSON(Message{Type: TypeInterim, ID: "utt-1", Text: text}))
+	}
+	interim := readMessageOfType(t, conns[1], TypeInterim)
+	assert.True(t, strings.HasSuffix(interim.ID, ":utt-1"))
+	assert.Equal(t, "[ja] good morning every", interim.Text)
+	assert.Equal(t, 1, translator.count("en->ja"))
+
+	// Unchanged text is not translated again
+	assert.NoError(t, conns[0].WriteJSON(Message{Type: TypeInterim, ID: "utt-1", Text: "good morning every"}))
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, 1, translator.count("en->ja"))
+
+	// The final message replaces the interim updates and stops further ones
+	assert.NoError(t, conns[0].WriteJSON(Message{Type: TypeInterim, ID: "utt-1", Text: "good morning everyone and"}))
+	assert.NoError(t, conns[0].WriteJSON(Message{Type: TypeMessage, ID: "utt-1", Text: "good morning everyone"}))
+	final := readMessageOfType(t, conns[1], TypeMessage)
+	assert.Equal(t, interim.ID, final.ID)
+	assert.Equal(t, "[ja] good morning everyone", final.Text)
+
+	conns[1].SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	var msg Message
+	for conns[1].ReadJSON(&msg) == nil {
+		assert.NotEqual(t, TypeInterim, msg.Type)
+	}
+}
+
+func TestWebSocket_UtteranceIDsPerSender(t *testing.T) {
+	ws, server := setupTest(nil, nil)
+	defer server.Close()
+
+	conns := connectWithLanguages(t, ws.roomManager, server.URL, []string{"en", "en", "ja"})
+
+	// Two speakers using the same utterance ID get different message IDs
+	assert.NoError(t, conns[0].WriteJSON(Message{Type: TypeMessage, ID: "utt-1", Text: "hello"}))
+	first := readMessageOfType(t, conns[2], TypeMessage)
+	assert.NoError(t, conns[1].WriteJSON(Message{Type: TypeMessage, ID: "utt-1", Text: "goodbye"}))
+	second := readMessageOfType(t, conns[2], TypeMessage)
+	assert.NotEqual(t, first.ID, second.ID)
+
+	// Resending an ID received from someone else does not reuse it
+	assert.NoError(t, conns[1].WriteJSON(Message{Type: TypeInterim, ID: first.ID, Text: "spoofed"}))
+	assert.NoError(t, conns[1].WriteJSON(Message{Type: TypeMessage, ID: first.ID, Text: "spoofed"}))
+	spoofed := readMessageOfType(t, conns[2], TypeMessage)
+	assert.NotEqual(t, first.ID, spoofed.ID)
+	assert.NotEqual(t, second.ID, spoofed.ID)
+}
+
+// multiTranslator counts multi-target calls on top of countingTranslator
+type multiTranslator struct {
+	countingTranslator
+}
+
+func (t *multiTranslator) TranslateMulti(ctx context.Context, text, fromLang string, toLangs []string) (map[string]string, error) {
+	t.mu.Lock()
+	t.calls["multi"]++
+	t.mu.Unlock()
+	translations := make(map[string]string, len(toLangs))
+	for _, lang := range toLangs {
+		translations[lang] = "[" + lang + "] " + text
+	}
+	return translations, nil
+}
+
+func TestWebSocket_MultiTarget(t *testing.T) {
+	translator := &multiTranslator{countingTranslator{calls: make(map[string]int)}}
+	ws, server := setupTest(translator, nil)
+	defer server.Close()
+
+	conns := connectWithLanguages(t, ws.roomManager, server.URL, []string{"en", "ja", "es", "en"})
+	assert.NoError(t, conns[0].WriteJSON(Message{Type: TypeMessage, Text: "hello"}))
+
+	assert.Equal(t, "[ja] hello", readMessageOfType(t, conns[1], TypeMessage).Text)
+	assert.Equal(t, "[es] hello", readMessageOfType(t, conns[2], TypeMessage).Text)
+	assert.Equal(t, "hello", readMessageOfType(t, conns[3], TypeMessage).Text)
+	assert.Equal(t, 1, translator.count("multi"))
+	assert.Equal(t, 0, translator.count("en->ja"))
+}
+
+func TestWebSocket_PreferencesLanguage(t *testing.T) {
+	ws, server := setupTest(nil, nil)
+	defer server.Close()
+	roomManager := ws.roomManager
+
+	conns := connectWithLanguages(t, roomManager, server.URL, []string{"pt-BR"})
+	client := roomManager.GetRoom("test-room").GetClients()[0]
+
+	// Tags are stored in canonical form
+	assert.NoError(t, conns[0].WriteJSON(Message{Type: TypePreferences, Language: "zh_hant"}))
+	assert.Eventually(t, func() bool { return client.GetLanguage() == "zh-Hant" }, time.Second, 10*time.Millisecond)
+
+	// Unknown languages are rejected and leave the preferences unchanged
+	assert.NoError(t, conns[0].WriteJSON(Message{Type: TypePreferences, Language: "klingon", Name: "Worf"}))
+	rejected := readMessageOfType(t, conns[0], TypeError)
+	assert.Equal(t, "klingon", rejected.Language)
+	assert.Contains(t, rejected.Text, "unknown language")
+	assert.Equal(t, "zh-Hant", client.GetLanguage())
+	assert.NotEqual(t, "Worf", client.GetName())
+}
+
+// formalityTranslator tags translations with the requested formality
+type formalityTranslator struct{}
+
+func (formalityTranslator) Translate(ctx context.Context, text, fromLang, toLang string) (string, error) {
+	return "[" + toLang + " " + string(translate.FormalityFromContext(ctx)) + "] " + text, nil
+}
+
+func TestWebSocket_Formality(t *testing.T) {
+	ws, server := setupTest(formalityTranslator{}, nil)
+	defer server.Close()
+
+	conns := connectWithLanguages(t, ws.roomManager, server.URL, []string{"en", "ja", "ja"})
+	room := ws.roomManager.GetRoom("test-room")
+
+	// One listener asks for formal Japanese, the other follows the room default
+	assert.NoError(t, conns[1].WriteJSON(Message{Type: TypePreferences, Formality: "formal"}))
+	assert.NoError(t, conns[0].WriteJSON(Message{Type: TypePreferences, RoomFormality: "informal"}))
+	assert.Eventually(t, func() bool {
+		groups := groupByTarget(room, nil)
+		return len(groups[target{lang: "ja", formality: translate.FormalityFormal}]) == 1 &&
+			len(groups[target{lang: "ja", formality: translate.FormalityInformal}]) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, conns[0].WriteJSON(Message{Type: TypeMessage, Text: "hello"}))
+	assert.Equal(t, "[ja formal] hello", readMessageOfType(t, conns[1], TypeMessage).Text)
+	assert.Equal(t, "[ja informal] hello", readMessageOfType(t, conns[2], TypeMessage).Text)
+
+	// Unknown values are rejected
+	assert.NoError(t, conns[1].WriteJSON(Message{Type: TypePreferences, Formality: "polite"}))
+	rejected := readMessageOfType(t, conns[1], TypeError)
+	assert.Equal(t, "polite", rejected.Formality)
+}
+
+func TestWebSocket_Quota(t *testing.T) {
+	translator := &countingTranslator{calls: make(map[string]int)}
+	cfg := DefaultConfig()
+	quotas, err := quota.NewManager(quota.Config{Unit: quota.UnitChars, User: quota.Limits{Daily: 10}})
+	assert.NoError(t, err)
+	cfg.Quotas = quotas
+	ws, server := setupTest(translator, cfg)
+	defer server.Close()
+
+	conns := connectWithLanguages(t, ws.roomManager, server.URL, []string{"en", "ja"})
+
+	// Two five-character messages use up the quota
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, conns[0].WriteJSON(Message{Type: TypeMessage, Text: "hello"}))
+		assert.Equal(t, "[ja] hello", readMessageOfType(t, conns[1], TypeMessage).Text)
+	}
+
+	// Then the speaker is told and messages pass through untranslated
+	assert.NoError(t, conns[0].WriteJSON(Message{Type: TypeMessage, Text: "hello"}))
+	exceeded := readMessageOfType(t, conns[0], TypeQuotaExceeded)
+	assert.Equal(t, quota.PeriodDaily, exceeded.Quota.Period)
+	assert.Equal(t, int64(10), exceeded.Quota.Used)
+	assert.Equal(t, "hello", readMessageOfType(t, conns[1], TypeMessage).Text)
+	assert.Equal(t, 2, translator.count("en->ja"))
+}
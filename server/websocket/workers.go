@@ -0,0 +1,55 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+)
+
+// workerPool bounds the number of in-flight translation calls per room, so a
+// busy or slow room cannot hold up translations in other rooms
+type workerPool struct {
+	size  int
+	mu    sync.Mutex
+	rooms map[string]*roomWorkers
+}
+
+// roomWorkers is the semaphore of one room, kept while anyone uses it
+type roomWorkers struct {
+	slots chan struct{}
+	users int
+}
+
+func newWorkerPool(size int) *workerPool {
+	if size < 1 {
+		size = defaultMaxConcurrentTranslations
+	}
+	return &workerPool{size: size, rooms: make(map[string]*roomWorkers)}
+}
+
+// acquire waits for a free slot in the room translations made with ctx are
+// for, and returns the function that frees it again
+func (p *workerPool) acquire(ctx context.Context) (release func()) {
+	room, _ := ctx.Value(roomKey{}).(string)
+
+	p.mu.Lock()
+	w, ok := p.rooms[room]
+	if !ok {
+		w = &roomWorkers{slots: make(chan struct{}, p.size)}
+		p.rooms[room] = w
+	}
+	w.users++
+	p.mu.Unlock()
+
+	w.slots <- struct{}{}
+	return func() {
+		<-w.slots
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if w.users--; w.users == 0 {
+			delete(p.rooms, room)
+		}
+	}
+}
+
+// roomKey is the context key of the room a translation is made for
+type roomKey struct{}